@@ -0,0 +1,604 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+package ecs // import "leopotam.com/go/ecs"
+
+import (
+	"math/bits"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+type CommandType int
+
+const (
+	CommandNewEntity        CommandType = 0
+	CommandDelEntity        CommandType = 1
+	CommandAddComponent     CommandType = 2
+	CommandDelComponent     CommandType = 3
+	CommandSetComponent     CommandType = 4
+	CommandReplaceComponent CommandType = 5
+	CommandCopyEntity       CommandType = 6
+)
+
+type CommandConflictReason int
+
+const (
+	// Entity was destroyed (or recycled) after command recording.
+	CommandConflictStaleEntity CommandConflictReason = 0
+	// Delayed entity was not created before command (or its creation was skipped).
+	CommandConflictUnresolvedEntity CommandConflictReason = 1
+	// Component already attached to entity on add.
+	CommandConflictComponentExists CommandConflictReason = 2
+	// Component not attached to entity on set / del.
+	CommandConflictComponentMissing CommandConflictReason = 3
+)
+
+// CommandConflict describes command skipped by playback.
+type CommandConflict struct {
+	Command CommandType
+	Entity  int
+	Reason  CommandConflictReason
+}
+
+// CommandsResult is summary of playback.
+type CommandsResult struct {
+	Applied int
+	Skipped int
+}
+
+const defaultCommandsSize int = 256
+
+// delayed entity contains playback cycle in high bits to detect
+// usage of entities, created before previous playback calls.
+const placeholderCycleShift = bits.UintSize / 2
+const placeholderCycleMask int = 1<<(placeholderCycleShift-1) - 1
+const placeholderIndexMask int = 1<<placeholderCycleShift - 1
+
+type command struct {
+	op       CommandType
+	entity   int
+	gen      int32
+	src      int
+	pool     int
+	poolItem int
+}
+
+// commandChunk is range of shard commands. Chunks are ordered by sequence
+// (incremented on each switch from worker to shared recording), shared chunk
+// goes first inside sequence, worker chunks - by chunk, shard and recording order.
+type commandChunk struct {
+	seq    int64
+	shared bool
+	chunk  int
+	shard  int
+	from   int
+	before int
+}
+
+type commandChunks []commandChunk
+
+func (x commandChunks) Len() int { return len(x) }
+func (x commandChunks) Less(i, j int) bool {
+	a, b := &x[i], &x[j]
+	if a.seq != b.seq {
+		return a.seq < b.seq
+	}
+	if a.shared != b.shared {
+		return a.shared
+	}
+	if a.chunk != b.chunk {
+		return a.chunk < b.chunk
+	}
+	if a.shard != b.shard {
+		return a.shard < b.shard
+	}
+	return a.from < b.from
+}
+func (x commandChunks) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+
+type CommandBufferConfig struct {
+	Capacity int
+	// Amount of worker shards for recording without locks from different goroutines.
+	ShardsCount int
+	// Optional callback for each skipped command.
+	ConflictHandler func(conflict CommandConflict)
+}
+
+type iCommandPool interface {
+	processAdd(shard, entity, itemID int) bool
+	processSet(shard, entity, itemID int) bool
+	processReplace(shard, entity, itemID int)
+	processDel(entity int) bool
+	reset()
+}
+
+// CommandBuffer is queue of structural changes of world, that will be applied
+// at Playback() call (automatically at the end of ISystems.Run() or at PlaybackHere() sync points).
+// Commands for destroyed / recycled entities will be skipped.
+type CommandBuffer struct {
+	sync            sync.Mutex
+	world           *World
+	shards          []*CommandShard
+	pools           []iCommandPool
+	poolsHashes     map[reflect.Type]iCommandPool
+	merged          commandChunks
+	conflictHandler func(conflict CommandConflict)
+	seq             int64
+	workersDirty    int32
+	cycle           int
+}
+
+// CommandShard records commands of one worker without locking,
+// should not be used from different goroutines at same time.
+type CommandShard struct {
+	buffer        *CommandBuffer
+	id            int
+	ops           []command
+	chunks        []commandChunk
+	applied       int
+	entitiesAdded []int
+	resolved      []int
+}
+
+type CommandPool[T any] struct {
+	buffer *CommandBuffer
+	pool   *Pool[T]
+	id     int
+	items  [][]T
+}
+
+func NewCommandBuffer(world *World) *CommandBuffer {
+	return NewCommandBufferWithConfig(world, CommandBufferConfig{})
+}
+
+func NewCommandBufferWithConfig(world *World, config CommandBufferConfig) *CommandBuffer {
+	if config.Capacity <= 0 {
+		config.Capacity = defaultCommandsSize
+	}
+	if config.ShardsCount < 0 {
+		config.ShardsCount = 0
+	}
+	b := &CommandBuffer{
+		world:           world,
+		poolsHashes:     make(map[reflect.Type]iCommandPool),
+		conflictHandler: config.ConflictHandler,
+	}
+	// last shard is shared between all goroutines and protected with lock.
+	b.shards = make([]*CommandShard, config.ShardsCount+1)
+	for i := range b.shards {
+		capacity := config.Capacity
+		if i < config.ShardsCount {
+			capacity /= config.ShardsCount
+		}
+		b.shards[i] = &CommandShard{buffer: b, id: i, ops: make([]command, 0, capacity)}
+	}
+	return b
+}
+
+// GetCommandBuffer returns command buffer of world, it will be created on first call.
+func (w *World) GetCommandBuffer() *CommandBuffer {
+	if w.commands == nil {
+		w.commands = NewCommandBuffer(w)
+	}
+	return w.commands
+}
+
+// GetCommandPool returns command pool for component type, it will be created on first call.
+// Creation of pool can touch world, it should not be done from different goroutines for new component types.
+func GetCommandPool[T any](b *CommandBuffer) *CommandPool[T] {
+	return GetCommandPoolWithCapacity[T](b, defaultCommandsSize)
+}
+
+// GetCommandPoolWithCapacity returns command pool for component type, capacity used only on pool creation.
+func GetCommandPoolWithCapacity[T any](b *CommandBuffer, capacity int) *CommandPool[T] {
+	itemType := reflect.TypeOf((*T)(nil))
+	b.sync.Lock()
+	defer b.sync.Unlock()
+	if p, ok := b.poolsHashes[itemType]; ok {
+		return p.(*CommandPool[T])
+	}
+	p := &CommandPool[T]{
+		buffer: b,
+		pool:   GetPool[T](b.world),
+		id:     len(b.pools),
+		items:  make([][]T, len(b.shards)),
+	}
+	for i := range p.items {
+		p.items[i] = make([]T, 0, capacity)
+	}
+	b.pools = append(b.pools, p)
+	b.poolsHashes[itemType] = p
+	return p
+}
+
+func (b *CommandBuffer) GetWorld() *World {
+	return b.world
+}
+
+func (b *CommandBuffer) GetShardsCount() int {
+	return len(b.shards) - 1
+}
+
+// GetShard returns command recorder for worker, commands of one task will be
+// applied in order of chunk (start index of processing range) and worker.
+// Commands of shared buffer API keep recording order relative to tasks.
+func (b *CommandBuffer) GetShard(worker, chunk int) *CommandShard {
+	if DEBUG && (worker < 0 || worker >= len(b.shards)-1) {
+		panic("invalid worker index for command shard")
+	}
+	shard := b.shards[worker]
+	seq := atomic.LoadInt64(&b.seq)
+	if l := len(shard.chunks); l == 0 || shard.chunks[l-1].chunk != chunk || shard.chunks[l-1].seq != seq {
+		shard.chunks = append(shard.chunks, commandChunk{seq: seq, chunk: chunk, shard: worker, from: len(shard.ops)})
+		atomic.StoreInt32(&b.workersDirty, 1)
+	}
+	return shard
+}
+
+// lockShared locks buffer and returns shared shard, new sequence
+// will be started if worker shards were used after last shared command.
+func (b *CommandBuffer) lockShared() *CommandShard {
+	b.sync.Lock()
+	shard := b.shards[len(b.shards)-1]
+	dirty := atomic.SwapInt32(&b.workersDirty, 0) == 1
+	if dirty || len(shard.chunks) == 0 {
+		seq := atomic.AddInt64(&b.seq, 1)
+		shard.chunks = append(shard.chunks, commandChunk{seq: seq, shared: true, shard: shard.id, from: len(shard.ops)})
+	}
+	return shard
+}
+
+// NewEntity returns delayed entity (negative id), that can be used only with commands.
+func (b *CommandBuffer) NewEntity() int {
+	entity := b.lockShared().NewEntity()
+	b.sync.Unlock()
+	return entity
+}
+
+func (b *CommandBuffer) DelEntity(entity int) {
+	if DEBUG && entity < 0 {
+		panic("cant delete delayed entity")
+	}
+	b.lockShared().DelEntity(entity)
+	b.sync.Unlock()
+}
+
+// CopyEntity returns delayed entity, that will be created as copy of source entity.
+func (b *CommandBuffer) CopyEntity(srcEntity int) int {
+	entity := b.lockShared().CopyEntity(srcEntity)
+	b.sync.Unlock()
+	return entity
+}
+
+// Resolve returns real entity for delayed entity, created at last playback call.
+// Non-delayed entities returned as is.
+func (b *CommandBuffer) Resolve(entity int) (int, bool) {
+	if entity >= 0 {
+		return entity, true
+	}
+	shard, idx, ok := b.decodePlaceholder(entity, b.cycle-1)
+	if !ok || idx >= len(shard.resolved) || shard.resolved[idx] < 0 {
+		return 0, false
+	}
+	return shard.resolved[idx], true
+}
+
+func (b *CommandBuffer) GetCommandsCount() int {
+	b.sync.Lock()
+	defer b.sync.Unlock()
+	count := 0
+	for _, shard := range b.shards {
+		count += len(shard.ops)
+	}
+	return count
+}
+
+// Playback applies all recorded commands and returns amount of skipped commands.
+func (b *CommandBuffer) Playback() int {
+	return b.PlaybackWithResult().Skipped
+}
+
+// PlaybackWithResult applies all recorded commands. Commands for destroyed / recycled entities
+// and conflicted component commands will be skipped and reported to ConflictHandler.
+func (b *CommandBuffer) PlaybackWithResult() CommandsResult {
+	var result CommandsResult
+	// commands, recorded by world listeners during playback, will be applied at same call.
+	for b.mergeChunks() {
+		for _, c := range b.merged {
+			shard := b.shards[c.shard]
+			for _, v := range shard.ops[c.from:c.before] {
+				if reason, ok := b.apply(shard, v); ok {
+					result.Applied++
+				} else {
+					result.Skipped++
+					if b.conflictHandler != nil {
+						entity := v.entity
+						if v.op == CommandCopyEntity {
+							entity = v.src
+						}
+						b.conflictHandler(CommandConflict{Command: v.op, Entity: entity, Reason: reason})
+					}
+				}
+			}
+		}
+	}
+	b.sync.Lock()
+	for _, shard := range b.shards {
+		shard.ops = shard.ops[:0]
+		shard.applied = 0
+		shard.resolved, shard.entitiesAdded = shard.entitiesAdded, shard.resolved[:0]
+		shard.chunks = shard.chunks[:0]
+	}
+	atomic.StoreInt32(&b.workersDirty, 0)
+	b.cycle++
+	for _, p := range b.pools {
+		p.reset()
+	}
+	b.sync.Unlock()
+	return result
+}
+
+// mergeChunks collects not applied chunks of all shards in order of processing.
+func (b *CommandBuffer) mergeChunks() bool {
+	b.sync.Lock()
+	defer b.sync.Unlock()
+	b.merged = b.merged[:0]
+	for _, shard := range b.shards {
+		for i, c := range shard.chunks {
+			if i < len(shard.chunks)-1 {
+				c.before = shard.chunks[i+1].from
+			} else {
+				c.before = len(shard.ops)
+			}
+			if c.from < shard.applied {
+				c.from = shard.applied
+			}
+			if c.before > c.from {
+				b.merged = append(b.merged, c)
+			}
+		}
+		shard.applied = len(shard.ops)
+	}
+	sort.Sort(b.merged)
+	return len(b.merged) > 0
+}
+
+func (b *CommandBuffer) apply(shard *CommandShard, v command) (CommandConflictReason, bool) {
+	switch v.op {
+	case CommandNewEntity:
+		_, idx, ok := b.decodePlaceholder(v.entity, b.cycle)
+		if !ok || idx >= len(shard.entitiesAdded) {
+			return CommandConflictUnresolvedEntity, false
+		}
+		shard.entitiesAdded[idx] = b.world.NewEntity()
+		return 0, true
+	case CommandCopyEntity:
+		src, reason, ok := b.validate(v.src, v.gen)
+		if !ok {
+			return reason, false
+		}
+		_, idx, ok := b.decodePlaceholder(v.entity, b.cycle)
+		if !ok || idx >= len(shard.entitiesAdded) {
+			return CommandConflictUnresolvedEntity, false
+		}
+		entity := b.world.NewEntity()
+		shard.entitiesAdded[idx] = entity
+		b.world.CopyEntity(src, entity)
+		return 0, true
+	}
+	entity, reason, ok := b.validate(v.entity, v.gen)
+	if !ok {
+		return reason, false
+	}
+	switch v.op {
+	case CommandDelEntity:
+		b.world.DelEntity(entity)
+	case CommandAddComponent:
+		if !b.pools[v.pool].processAdd(shard.id, entity, v.poolItem) {
+			return CommandConflictComponentExists, false
+		}
+	case CommandSetComponent:
+		if !b.pools[v.pool].processSet(shard.id, entity, v.poolItem) {
+			return CommandConflictComponentMissing, false
+		}
+	case CommandReplaceComponent:
+		b.pools[v.pool].processReplace(shard.id, entity, v.poolItem)
+	case CommandDelComponent:
+		if !b.pools[v.pool].processDel(entity) {
+			return CommandConflictComponentMissing, false
+		}
+	}
+	return 0, true
+}
+
+// validate resolves delayed entity and checks that entity still alive with same generation.
+func (b *CommandBuffer) validate(entity int, gen int32) (int, CommandConflictReason, bool) {
+	if entity < 0 {
+		shard, idx, ok := b.decodePlaceholder(entity, b.cycle)
+		if !ok || idx >= len(shard.entitiesAdded) {
+			return 0, CommandConflictUnresolvedEntity, false
+		}
+		resolved := shard.entitiesAdded[idx]
+		if resolved < 0 {
+			return 0, CommandConflictUnresolvedEntity, false
+		}
+		if !b.world.checkEntityAlive(resolved) {
+			return 0, CommandConflictStaleEntity, false
+		}
+		return resolved, 0, true
+	}
+	if gen <= 0 || b.world.GetEntityGen(entity) != gen {
+		return 0, CommandConflictStaleEntity, false
+	}
+	return entity, 0, true
+}
+
+func (b *CommandBuffer) newPlaceholder(shard *CommandShard) int {
+	idx := len(shard.entitiesAdded)*len(b.shards) + shard.id
+	if DEBUG && idx > placeholderIndexMask {
+		panic("too many delayed entities, playback should be called")
+	}
+	return -((b.cycle&placeholderCycleMask)<<placeholderCycleShift | idx) - 1
+}
+
+// decodePlaceholder returns shard and index of delayed entity, false - entity was created at another cycle.
+func (b *CommandBuffer) decodePlaceholder(entity, cycle int) (*CommandShard, int, bool) {
+	v := -(entity + 1)
+	if v>>placeholderCycleShift != cycle&placeholderCycleMask {
+		return nil, 0, false
+	}
+	v &= placeholderIndexMask
+	return b.shards[v%len(b.shards)], v / len(b.shards), true
+}
+
+// entityGen returns generation of entity at recording time, zero for delayed / not alive entities.
+func (b *CommandBuffer) entityGen(entity int) int32 {
+	if !b.world.checkEntityAlive(entity) {
+		return 0
+	}
+	return b.world.GetEntityGen(entity)
+}
+
+func (s *CommandShard) NewEntity() int {
+	entity := s.buffer.newPlaceholder(s)
+	s.entitiesAdded = append(s.entitiesAdded, -1)
+	s.ops = append(s.ops, command{op: CommandNewEntity, entity: entity})
+	return entity
+}
+
+func (s *CommandShard) CopyEntity(srcEntity int) int {
+	entity := s.buffer.newPlaceholder(s)
+	s.entitiesAdded = append(s.entitiesAdded, -1)
+	s.ops = append(s.ops, command{
+		op:     CommandCopyEntity,
+		entity: entity,
+		gen:    s.buffer.entityGen(srcEntity),
+		src:    srcEntity,
+	})
+	return entity
+}
+
+func (s *CommandShard) DelEntity(entity int) {
+	if DEBUG && entity < 0 {
+		panic("cant delete delayed entity")
+	}
+	s.ops = append(s.ops, command{
+		op:     CommandDelEntity,
+		entity: entity,
+		gen:    s.buffer.entityGen(entity),
+	})
+}
+
+func (p *CommandPool[T]) Add(entity int, v T) {
+	p.ShardAdd(p.buffer.lockShared(), entity, v)
+	p.buffer.sync.Unlock()
+}
+
+func (p *CommandPool[T]) ShardAdd(shard *CommandShard, entity int, v T) {
+	p.shardValue(shard, CommandAddComponent, entity, v)
+}
+
+// Set overwrites value of existing component.
+func (p *CommandPool[T]) Set(entity int, v T) {
+	p.ShardSet(p.buffer.lockShared(), entity, v)
+	p.buffer.sync.Unlock()
+}
+
+func (p *CommandPool[T]) ShardSet(shard *CommandShard, entity int, v T) {
+	p.shardValue(shard, CommandSetComponent, entity, v)
+}
+
+// Replace adds component or overwrites value of existing one.
+func (p *CommandPool[T]) Replace(entity int, v T) {
+	p.ShardReplace(p.buffer.lockShared(), entity, v)
+	p.buffer.sync.Unlock()
+}
+
+func (p *CommandPool[T]) ShardReplace(shard *CommandShard, entity int, v T) {
+	p.shardValue(shard, CommandReplaceComponent, entity, v)
+}
+
+func (p *CommandPool[T]) Del(entity int) {
+	if DEBUG && entity < 0 {
+		panic("cant delete delayed component")
+	}
+	p.ShardDel(p.buffer.lockShared(), entity)
+	p.buffer.sync.Unlock()
+}
+
+func (p *CommandPool[T]) ShardDel(shard *CommandShard, entity int) {
+	if DEBUG && shard.buffer != p.buffer {
+		panic("shard belongs to another buffer")
+	}
+	if DEBUG && entity < 0 {
+		panic("cant delete delayed component")
+	}
+	shard.ops = append(shard.ops, command{
+		op:     CommandDelComponent,
+		entity: entity,
+		gen:    p.buffer.entityGen(entity),
+		pool:   p.id,
+	})
+}
+
+func (p *CommandPool[T]) shardValue(shard *CommandShard, op CommandType, entity int, v T) {
+	if DEBUG && shard.buffer != p.buffer {
+		panic("shard belongs to another buffer")
+	}
+	itemID := len(p.items[shard.id])
+	p.items[shard.id] = append(p.items[shard.id], v)
+	shard.ops = append(shard.ops, command{
+		op:       op,
+		entity:   entity,
+		gen:      p.buffer.entityGen(entity),
+		pool:     p.id,
+		poolItem: itemID,
+	})
+}
+
+func (p *CommandPool[T]) processAdd(shard, entity, itemID int) bool {
+	if p.pool.Has(entity) {
+		return false
+	}
+	*p.pool.Add(entity) = p.items[shard][itemID]
+	return true
+}
+
+func (p *CommandPool[T]) processSet(shard, entity, itemID int) bool {
+	if !p.pool.Has(entity) {
+		return false
+	}
+	*p.pool.Get(entity) = p.items[shard][itemID]
+	return true
+}
+
+func (p *CommandPool[T]) processReplace(shard, entity, itemID int) {
+	if p.pool.Has(entity) {
+		*p.pool.Get(entity) = p.items[shard][itemID]
+	} else {
+		*p.pool.Add(entity) = p.items[shard][itemID]
+	}
+}
+
+func (p *CommandPool[T]) processDel(entity int) bool {
+	if !p.pool.Has(entity) {
+		return false
+	}
+	p.pool.Del(entity)
+	return true
+}
+
+func (p *CommandPool[T]) reset() {
+	var defaultT T
+	for i, items := range p.items {
+		for j := range items {
+			items[j] = defaultT
+		}
+		p.items[i] = items[:0]
+	}
+}
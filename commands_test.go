@@ -0,0 +1,242 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+package ecs_test
+
+import (
+	"testing"
+
+	"leopotam.com/go/ecs"
+)
+
+type CommandsDelSystem1 struct{}
+
+type CommandsCountSystem1 struct {
+	Counts []int
+}
+
+func (s *CommandsDelSystem1) Run(systems ecs.ISystems) {
+	w := systems.GetWorld("")
+	cb := w.GetCommandBuffer()
+	for _, e := range ecs.GetFilter[ecs.Inc1[C2]](w).GetRawEntities() {
+		cb.DelEntity(e)
+	}
+	ecs.GetCommandPool[C2](cb).Add(cb.NewEntity(), C2{ID: 1})
+}
+
+func (s *CommandsCountSystem1) Run(systems ecs.ISystems) {
+	s.Counts = append(s.Counts, ecs.GetFilter[ecs.Inc1[C2]](systems.GetWorld("")).GetEntitiesCount())
+}
+
+func TestCommands(t *testing.T) {
+	w := ecs.NewWorld()
+	p := ecs.GetPool[C2](w)
+	cb := w.GetCommandBuffer()
+	if w.GetCommandBuffer() != cb {
+		t.Errorf("command buffer should be same instance")
+	}
+	cp := ecs.GetCommandPool[C2](cb)
+	if ecs.GetCommandPool[C2](cb) != cp {
+		t.Errorf("command pool should be same instance")
+	}
+	e := cb.NewEntity()
+	cp.Add(e, C2{ID: 1})
+	copied := cb.CopyEntity(e)
+	cp.Set(copied, C2{ID: 2})
+	if cb.GetCommandsCount() != 4 {
+		t.Errorf("invalid commands count: %v", cb.GetCommandsCount())
+	}
+	if _, ok := cb.Resolve(e); ok {
+		t.Errorf("delayed entity should not be resolved before playback")
+	}
+	if skipped := cb.Playback(); skipped != 0 {
+		t.Errorf("invalid skipped commands: %v", skipped)
+	}
+	e1, ok1 := cb.Resolve(e)
+	e2, ok2 := cb.Resolve(copied)
+	if !ok1 || !ok2 || e1 == e2 {
+		t.Fatalf("invalid resolved entities")
+	}
+	if p.Get(e1).ID != 1 || p.Get(e2).ID != 2 {
+		t.Errorf("invalid components: %v, %v", p.Get(e1).ID, p.Get(e2).ID)
+	}
+	cp.Replace(e1, C2{ID: 3})
+	cp.Del(e2)
+	cb.DelEntity(e2)
+	cp.Set(e2, C2{ID: 4})
+	// component removal kills entity, other commands for it are stale.
+	if skipped := cb.Playback(); skipped != 2 {
+		t.Errorf("invalid skipped commands: %v", skipped)
+	}
+	if p.Get(e1).ID != 3 {
+		t.Errorf("invalid component after replace: %v", p.Get(e1).ID)
+	}
+	if cb.GetCommandsCount() != 0 {
+		t.Errorf("commands should be cleared after playback")
+	}
+	w.Destroy()
+}
+
+func TestCommandsAutoPlayback(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	counter := &CommandsCountSystem1{}
+	s.Add(&CommandsDelSystem1{}).Add(counter)
+	s.Init()
+	s.Run()
+	s.Run()
+	if len(counter.Counts) != 2 || counter.Counts[0] != 0 || counter.Counts[1] != 1 {
+		t.Errorf("invalid filter counts: %v", counter.Counts)
+	}
+	if c := ecs.GetFilter[ecs.Inc1[C2]](w).GetEntitiesCount(); c != 1 {
+		t.Errorf("invalid entities count: %v", c)
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestCommandsPlaybackHere(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystemsWithConfig(w, ecs.SystemsConfig{ManualCommandsPlayback: true})
+	counter1 := &CommandsCountSystem1{}
+	counter2 := &CommandsCountSystem1{}
+	s.Add(&CommandsDelSystem1{}).Add(counter1)
+	ecs.PlaybackHere(s, "").Add(counter2).Add(&CommandsDelSystem1{})
+	s.Init()
+	s.Run()
+	if len(counter1.Counts) != 1 || counter1.Counts[0] != 0 || counter2.Counts[0] != 1 {
+		t.Errorf("invalid filter counts: %v, %v", counter1.Counts, counter2.Counts)
+	}
+	// commands of last system should be kept until next sync point.
+	if c := w.GetCommandBuffer().GetCommandsCount(); c != 3 {
+		t.Errorf("invalid commands count: %v", c)
+	}
+	s.Destroy()
+	w.GetCommandBuffer().Playback()
+	w.Destroy()
+}
+
+func TestCommandsPlaybackHereFromUndefinedWorld(t *testing.T) {
+	w := ecs.NewWorld()
+	systems := ecs.NewSystems(w)
+	defer func(world *ecs.World, systems ecs.ISystems) {
+		if r := recover(); r == nil {
+			t.Errorf("code should panic")
+		}
+		systems.Destroy()
+		world.Destroy()
+	}(w, systems)
+	ecs.PlaybackHere(systems, "events").Init()
+	systems.Run()
+	t.Errorf("code should panic")
+}
+
+func TestCommandsStaleDelayedEntity(t *testing.T) {
+	w := ecs.NewWorld()
+	var conflicts []ecs.CommandConflict
+	cb := ecs.NewCommandBufferWithConfig(w, ecs.CommandBufferConfig{
+		ConflictHandler: func(conflict ecs.CommandConflict) {
+			conflicts = append(conflicts, conflict)
+		},
+	})
+	cp := ecs.GetCommandPool[C2](cb)
+	old := cb.NewEntity()
+	cp.Add(old, C2{ID: 1})
+	cb.Playback()
+	// delayed entity of previous playback should not be resolved with new entity.
+	cp.Add(cb.NewEntity(), C2{ID: 2})
+	cp.Set(old, C2{ID: 3})
+	// out of range index.
+	cp.Add(-1000, C2{})
+	if res := cb.PlaybackWithResult(); res.Applied != 2 || res.Skipped != 2 {
+		t.Errorf("invalid playback result: %+v", res)
+	}
+	for _, c := range conflicts {
+		if c.Reason != ecs.CommandConflictUnresolvedEntity {
+			t.Errorf("invalid conflict: %+v", c)
+		}
+	}
+	if _, ok := cb.Resolve(old); ok {
+		t.Errorf("delayed entity of previous playback should not be resolved")
+	}
+	if _, ok := cb.Resolve(-1000); ok {
+		t.Errorf("out of range delayed entity should not be resolved")
+	}
+	w.Destroy()
+}
+
+func TestCommandsOutOfRangeEntity(t *testing.T) {
+	w := ecs.NewWorld()
+	var conflicts []ecs.CommandConflict
+	cb := ecs.NewCommandBufferWithConfig(w, ecs.CommandBufferConfig{
+		ConflictHandler: func(conflict ecs.CommandConflict) {
+			conflicts = append(conflicts, conflict)
+		},
+	})
+	cb.DelEntity(100000)
+	ecs.GetCommandPool[C2](cb).Add(100000, C2{})
+	cb.CopyEntity(100000)
+	if res := cb.PlaybackWithResult(); res.Applied != 0 || res.Skipped != 3 {
+		t.Errorf("invalid playback result: %+v", res)
+	}
+	for _, c := range conflicts {
+		if c.Reason != ecs.CommandConflictStaleEntity {
+			t.Errorf("invalid conflict: %+v", c)
+		}
+	}
+	if w.GetAliveEntitiesCount() != 0 {
+		t.Errorf("invalid entities count: %v", w.GetAliveEntitiesCount())
+	}
+	w.Destroy()
+}
+
+func TestCommandsShards(t *testing.T) {
+	w := ecs.NewWorld()
+	p := ecs.GetPool[C2](w)
+	cb := ecs.NewCommandBufferWithConfig(w, ecs.CommandBufferConfig{ShardsCount: 2})
+	cp := ecs.GetCommandPool[C2](cb)
+	cp.Add(cb.NewEntity(), C2{ID: 1})
+	shard := cb.GetShard(1, 10)
+	cp.ShardAdd(shard, shard.NewEntity(), C2{ID: 3})
+	shard = cb.GetShard(0, 0)
+	cp.ShardAdd(shard, shard.NewEntity(), C2{ID: 2})
+	if cb.GetCommandsCount() != 6 {
+		t.Errorf("invalid commands count: %v", cb.GetCommandsCount())
+	}
+	cb.Playback()
+	for i := 0; i < 3; i++ {
+		if p.Get(i).ID != i+1 {
+			t.Errorf("invalid component order at %v: %v", i, p.Get(i).ID)
+		}
+	}
+	w.Destroy()
+}
+
+type commandsRefListener struct {
+	cb *ecs.CommandBuffer
+}
+
+func (l *commandsRefListener) OnEntityRefReset(referrer, target int, refPool ecs.IPool) {
+	ecs.GetCommandPool[C2](l.cb).Add(l.cb.NewEntity(), C2{ID: referrer})
+}
+
+func TestCommandsRecordDuringPlayback(t *testing.T) {
+	w := ecs.NewWorld()
+	cb := w.GetCommandBuffer()
+	w.AddEntityRefListener(&commandsRefListener{cb: cb})
+	target := w.NewEntity()
+	ecs.GetPool[C1](w).Add(target)
+	referrer := w.NewEntity()
+	ecs.SetEntityRef[RefOwner](w, referrer, target, ecs.RefNotify)
+	cb.DelEntity(target)
+	// commands of listener should be applied at same playback.
+	if res := cb.PlaybackWithResult(); res.Applied != 3 || res.Skipped != 0 {
+		t.Errorf("invalid playback result: %+v", res)
+	}
+	if list := ecs.GetFilter[ecs.Inc1[C2]](w).GetRawEntities(); len(list) != 1 || ecs.GetPool[C2](w).Get(list[0]).ID != referrer {
+		t.Errorf("invalid entities created during playback: %v", list)
+	}
+	w.Destroy()
+}
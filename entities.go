@@ -7,12 +7,12 @@ package ecs // import "leopotam.com/go/ecs"
 
 type PackedEntity struct {
 	id  int
-	gen int16
+	gen int32
 }
 
 type PackedEntityWithWorld struct {
 	id  int
-	gen int16
+	gen int32
 	w   *World
 }
 
@@ -27,6 +27,16 @@ func (pe PackedEntity) Unpack(w *World) (int, bool) {
 	return pe.id, true
 }
 
+func (pe PackedEntity) Equals(other PackedEntity) bool {
+	return pe.id == other.id && pe.gen == other.gen
+}
+
+// IsValid checks that packed entity is still alive in world.
+func (pe PackedEntity) IsValid(w *World) bool {
+	_, ok := pe.Unpack(w)
+	return ok
+}
+
 func (w *World) PackEntityWithWorld(entity int) PackedEntityWithWorld {
 	return PackedEntityWithWorld{id: entity, gen: w.GetEntityGen(entity), w: w}
 }
@@ -37,3 +47,59 @@ func (pe PackedEntityWithWorld) Unpack() (*World, int, bool) {
 	}
 	return pe.w, pe.id, true
 }
+
+func (pe PackedEntityWithWorld) Equals(other PackedEntityWithWorld) bool {
+	return pe.id == other.id && pe.gen == other.gen && pe.w == other.w
+}
+
+func (pe PackedEntityWithWorld) IsValid() bool {
+	_, _, ok := pe.Unpack()
+	return ok
+}
+
+type EntitiesIter struct {
+	w      *World
+	idx    int
+	entity int
+}
+
+func (i *EntitiesIter) Next() bool {
+	for {
+		i.idx++
+		if i.idx*i.w.entitiesItemSize >= len(i.w.entities) {
+			return false
+		}
+		if i.w.getRawEntityGen(i.w.GetRawEntityOffset(i.idx)) > 0 {
+			i.entity = i.idx
+			return true
+		}
+	}
+}
+
+func (i *EntitiesIter) GetEntity() int {
+	return i.entity
+}
+
+// EntityHandle is packed entity (index in low 32 bits, generation in high 32 bits),
+// can be used as map key. Zero value is invalid handle.
+type EntityHandle uint64
+
+func (w *World) GetEntityHandle(entity int) EntityHandle {
+	return EntityHandle(uint64(uint32(w.GetEntityGen(entity)))<<32 | uint64(uint32(entity)))
+}
+
+func (h EntityHandle) GetIndex() int {
+	return int(uint32(h))
+}
+
+func (h EntityHandle) GetGen() int32 {
+	return int32(uint32(h >> 32))
+}
+
+func (h EntityHandle) Unpack(w *World) (int, bool) {
+	entity := h.GetIndex()
+	if !w.checkEntityAlive(entity) || w.GetEntityGen(entity) != h.GetGen() {
+		return 0, false
+	}
+	return entity, true
+}
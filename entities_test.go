@@ -6,6 +6,7 @@
 package ecs_test
 
 import (
+	"math"
 	"testing"
 
 	"leopotam.com/go/ecs"
@@ -38,3 +39,50 @@ func TestPackedEntityWithWorld(t *testing.T) {
 	}
 	w.Destroy()
 }
+
+func TestEntityHandle(t *testing.T) {
+	w := ecs.NewWorld()
+	e := w.NewEntity()
+	ecs.DebugSetEntityGen(w, e, math.MaxInt16+10)
+	h := w.GetEntityHandle(e)
+	if h.GetIndex() != e || h.GetGen() != math.MaxInt16+10 {
+		t.Errorf("invalid handle data: %v, %v", h.GetIndex(), h.GetGen())
+	}
+	handles := map[ecs.EntityHandle]int{h: e}
+	if unpacked, ok := h.Unpack(w); !ok || unpacked != e || handles[w.GetEntityHandle(e)] != e {
+		t.Errorf("invalid entity handle")
+	}
+	w.DelEntity(e)
+	if _, ok := h.Unpack(w); ok {
+		t.Errorf("invalid entity handle after removing")
+	}
+	if _, ok := ecs.EntityHandle(0).Unpack(w); ok {
+		t.Errorf("zero handle should be invalid")
+	}
+	w.Destroy()
+}
+
+func TestPackedEntityEqualsAndIsValid(t *testing.T) {
+	w := ecs.NewWorld()
+	e := w.NewEntity()
+	pe1 := w.PackEntity(e)
+	pe2 := w.PackEntity(e)
+	pw1 := w.PackEntityWithWorld(e)
+	pw2 := w.PackEntityWithWorld(e)
+	if !pe1.Equals(pe2) || !pw1.Equals(pw2) {
+		t.Errorf("packed entities should be equal")
+	}
+	if !pe1.IsValid(w) || !pw1.IsValid() {
+		t.Errorf("packed entities should be valid")
+	}
+	w.DelEntity(e)
+	e = w.NewEntity()
+	if pe1.Equals(w.PackEntity(e)) || pw1.Equals(w.PackEntityWithWorld(e)) {
+		t.Errorf("packed entities with different gens should not be equal")
+	}
+	if pe1.IsValid(w) || pw1.IsValid() {
+		t.Errorf("packed entities should be invalid after removing")
+	}
+	w.DelEntity(e)
+	w.Destroy()
+}
@@ -0,0 +1,123 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+package ecs // import "leopotam.com/go/ecs"
+
+import (
+	"fmt"
+	"reflect"
+)
+
+type EventsMode int
+
+const (
+	// Events can be read right after Send() and will be cleared at the end of ISystems.Run().
+	EventsModeFrame EventsMode = 0
+	// Events can be read only at next ISystems.Run(), all systems will see them.
+	EventsModeDoubleBuffered EventsMode = 1
+)
+
+const defaultEventsSize int = 64
+
+type iEvents interface {
+	getMode() EventsMode
+	update()
+}
+
+type Events[T any] struct {
+	mode  EventsMode
+	items []T
+	next  []T
+}
+
+type EventsIter[T any] struct {
+	items []T
+	idx   int
+}
+
+func (i *EventsIter[T]) Next() bool {
+	i.idx++
+	return i.idx < len(i.items)
+}
+
+func (i *EventsIter[T]) Get() *T {
+	return &i.items[i.idx]
+}
+
+func newEvents[T any](mode EventsMode) *Events[T] {
+	e := &Events[T]{mode: mode}
+	e.items = make([]T, 0, defaultEventsSize)
+	if mode == EventsModeDoubleBuffered {
+		e.next = make([]T, 0, defaultEventsSize)
+	}
+	return e
+}
+
+func (e *Events[T]) Send(evt T) {
+	if e.mode == EventsModeDoubleBuffered {
+		e.next = append(e.next, evt)
+	} else {
+		e.items = append(e.items, evt)
+	}
+}
+
+func (e *Events[T]) Iter() EventsIter[T] {
+	return EventsIter[T]{items: e.items, idx: -1}
+}
+
+func (e *Events[T]) GetCount() int {
+	return len(e.items)
+}
+
+func (e *Events[T]) GetRaw() []T {
+	return e.items
+}
+
+func (e *Events[T]) getMode() EventsMode {
+	return e.mode
+}
+
+func (e *Events[T]) update() {
+	var defaultT T
+	for i := range e.items {
+		e.items[i] = defaultT
+	}
+	if e.mode == EventsModeDoubleBuffered {
+		e.items, e.next = e.next, e.items[:0]
+	} else {
+		e.items = e.items[:0]
+	}
+}
+
+func (w *World) UpdateEvents() {
+	for _, e := range w.eventsList {
+		e.update()
+	}
+}
+
+func GetEvents[T any](w *World) *Events[T] {
+	if e, ok := w.eventsHashes[reflect.TypeOf((*T)(nil))]; ok {
+		return e.(*Events[T])
+	}
+	return GetEventsWithMode[T](w, EventsModeFrame)
+}
+
+func GetEventsWithMode[T any](w *World, mode EventsMode) *Events[T] {
+	itemType := reflect.TypeOf((*T)(nil))
+	if e, ok := w.eventsHashes[itemType]; ok {
+		if DEBUG && e.getMode() != mode {
+			panic(fmt.Sprintf("events \"%s\" already registered with another mode", itemType.Elem().String()))
+		}
+		return e.(*Events[T])
+	}
+	e := newEvents[T](mode)
+	w.eventsHashes[itemType] = e
+	w.eventsList = append(w.eventsList, e)
+	return e
+}
+
+func Send[T any](w *World, evt T) {
+	GetEvents[T](w).Send(evt)
+}
@@ -0,0 +1,114 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+package ecs_test
+
+import (
+	"testing"
+
+	"leopotam.com/go/ecs"
+)
+
+type Evt1 struct{ ID int }
+
+type EventSendSystem1 struct{}
+type EventReadSystem1 struct {
+	Received []int
+}
+
+func (s *EventSendSystem1) Run(systems ecs.ISystems) {
+	ecs.Send(systems.GetWorld(""), Evt1{ID: 1})
+}
+
+func (s *EventReadSystem1) Run(systems ecs.ISystems) {
+	events := ecs.GetEvents[Evt1](systems.GetWorld(""))
+	for it := events.Iter(); it.Next(); {
+		s.Received = append(s.Received, it.Get().ID)
+	}
+}
+
+func TestEventsFrameMode(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	reader1 := &EventReadSystem1{}
+	reader2 := &EventReadSystem1{}
+	s.
+		Add(reader1).
+		Add(&EventSendSystem1{}).
+		Add(reader2).
+		Init()
+	s.Run()
+	s.Run()
+	if len(reader1.Received) != 0 {
+		t.Errorf("events should be cleared at end of frame: %v", reader1.Received)
+	}
+	if len(reader2.Received) != 2 {
+		t.Errorf("invalid received events: %v", reader2.Received)
+	}
+	if ecs.GetEvents[Evt1](w).GetCount() != 0 {
+		t.Errorf("events should be cleared")
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestEventsDoubleBufferedMode(t *testing.T) {
+	w := ecs.NewWorld()
+	ecs.GetEventsWithMode[Evt1](w, ecs.EventsModeDoubleBuffered)
+	s := ecs.NewSystems(w)
+	reader1 := &EventReadSystem1{}
+	reader2 := &EventReadSystem1{}
+	s.
+		Add(reader1).
+		Add(&EventSendSystem1{}).
+		Add(reader2).
+		Init()
+	s.Run()
+	if len(reader1.Received) != 0 || len(reader2.Received) != 0 {
+		t.Errorf("events should not be visible at same frame")
+	}
+	s.Run()
+	if len(reader1.Received) != 1 || len(reader2.Received) != 1 {
+		t.Errorf("events should be visible at next frame: %v, %v", reader1.Received, reader2.Received)
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestEventsNamedWorld(t *testing.T) {
+	w1 := ecs.NewWorld()
+	w2 := ecs.NewWorld()
+	s := ecs.NewSystems(w1)
+	s.
+		AddWorld(w2, "events").
+		AddWorld(w2, "events2").
+		Init()
+	events := ecs.GetEventsWithMode[Evt1](w2, ecs.EventsModeDoubleBuffered)
+	events.Send(Evt1{ID: 1})
+	s.Run()
+	if events.GetCount() != 1 {
+		t.Errorf("invalid events count after single update: %v", events.GetCount())
+	}
+	s.Run()
+	if events.GetCount() != 0 {
+		t.Errorf("invalid events count: %v", events.GetCount())
+	}
+	s.Destroy()
+	w1.Destroy()
+	w2.Destroy()
+}
+
+func TestEventsInvalidMode(t *testing.T) {
+	w := ecs.NewWorld()
+	defer func(world *ecs.World) {
+		if r := recover(); r == nil {
+			t.Errorf("code should panic")
+		}
+		world.Destroy()
+	}(w)
+	ecs.GetEvents[Evt1](w)
+	ecs.GetEventsWithMode[Evt1](w, ecs.EventsModeDoubleBuffered)
+	t.Errorf("code should panic")
+}
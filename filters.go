@@ -35,6 +35,12 @@ type IExc interface {
 	FillExcludes(w *World, list []int16) []int16
 }
 
+// IExcPools is optional extension of IExc with access to pools of excluded components.
+type IExcPools interface {
+	IExc
+	FillPools(w *World) IExc
+}
+
 type FilterIter struct {
 	f      *Filter
 	locked bool
@@ -204,7 +210,14 @@ func (f *Filter) removeEntity(entity int) {
 
 func (f *Filter) unlock() {
 	f.locks--
-	if f.locks == 0 && len(f.delayed) > 0 {
+	f.world.filtersLocks--
+	if f.locks == 0 {
+		f.applyDelayed()
+	}
+}
+
+func (f *Filter) applyDelayed() {
+	if len(f.delayed) > 0 {
 		for _, op := range f.delayed {
 			if op.added {
 				f.addEntity(op.entity)
@@ -222,6 +235,7 @@ func (f *Filter) getMask() *mask {
 
 func (f *Filter) Iter() FilterIter {
 	f.locks++
+	f.world.filtersLocks++
 	return FilterIter{
 		f:      f,
 		locked: true,
@@ -431,23 +445,88 @@ func (i Inc6[I1, I2, I3, I4, I5, I6]) FillPools(w *World) IInc {
 	}
 }
 
-type Exc1[E1 any] struct{}
+type Exc1[E1 any] struct {
+	Exc1 *Pool[E1]
+}
 
 func (e Exc1[E1]) FillExcludes(w *World, list []int16) []int16 {
 	return append(list, GetPool[E1](w).GetID())
 }
 
-type Exc2[E1 any, E2 any] struct{}
+func (e Exc1[E1]) FillPools(w *World) IExc {
+	return &Exc1[E1]{
+		Exc1: GetPool[E1](w),
+	}
+}
+
+type Exc2[E1 any, E2 any] struct {
+	Exc1 *Pool[E1]
+	Exc2 *Pool[E2]
+}
 
 func (e Exc2[E1, E2]) FillExcludes(w *World, list []int16) []int16 {
 	list = append(list, GetPool[E1](w).GetID())
 	return append(list, GetPool[E2](w).GetID())
 }
 
-type Exc3[E1 any, E2 any, E3 any] struct{}
+func (e Exc2[E1, E2]) FillPools(w *World) IExc {
+	return &Exc2[E1, E2]{
+		Exc1: GetPool[E1](w),
+		Exc2: GetPool[E2](w),
+	}
+}
+
+type Exc3[E1 any, E2 any, E3 any] struct {
+	Exc1 *Pool[E1]
+	Exc2 *Pool[E2]
+	Exc3 *Pool[E3]
+}
 
 func (e Exc3[E1, E2, E3]) FillExcludes(w *World, list []int16) []int16 {
 	list = append(list, GetPool[E1](w).GetID())
 	list = append(list, GetPool[E2](w).GetID())
 	return append(list, GetPool[E3](w).GetID())
 }
+
+func (e Exc3[E1, E2, E3]) FillPools(w *World) IExc {
+	return &Exc3[E1, E2, E3]{
+		Exc1: GetPool[E1](w),
+		Exc2: GetPool[E2](w),
+		Exc3: GetPool[E3](w),
+	}
+}
+
+type filterLock struct {
+	filter *Filter
+	locks  int
+}
+
+func appendFilterLocks(w *World, locks []filterLock) []filterLock {
+	if w.filtersLocks > 0 {
+		for _, f := range w.filtersHashes {
+			if f.locks > 0 {
+				locks = append(locks, filterLock{filter: f, locks: f.locks})
+			}
+		}
+	}
+	return locks
+}
+
+// restoreFilterLocks returns locks of world filters to saved state
+// (iterators can be left not destroyed after recovered panic) and applies delayed changes of unlocked filters.
+func restoreFilterLocks(w *World, locks []filterLock) {
+	w.filtersLocks = 0
+	for _, f := range w.filtersHashes {
+		f.locks = 0
+		for _, l := range locks {
+			if l.filter == f {
+				f.locks = l.locks
+				break
+			}
+		}
+		w.filtersLocks += f.locks
+		if f.locks == 0 {
+			f.applyDelayed()
+		}
+	}
+}
@@ -94,6 +94,25 @@ func TestFilterConstraintFillPools(t *testing.T) {
 	w.Destroy()
 }
 
+func TestFilterConstraintFillExcPools(t *testing.T) {
+	w := ecs.NewWorld()
+	var e1 ecs.IExcPools = ecs.Exc1[C1]{}
+	var e2 ecs.IExcPools = ecs.Exc2[C1, C2]{}
+	var e3 ecs.IExcPools = ecs.Exc3[C1, C2, C3]{}
+	e11 := e1.FillPools(w).(*ecs.Exc1[C1])
+	e21 := e2.FillPools(w).(*ecs.Exc2[C1, C2])
+	e31 := e3.FillPools(w).(*ecs.Exc3[C1, C2, C3])
+	if e31.Exc1 == nil ||
+		e31.Exc2 == nil ||
+		e31.Exc3 == nil ||
+		e31.Exc1 != e11.Exc1 ||
+		e31.Exc2 != e21.Exc2 ||
+		e31.Exc3 != ecs.GetPool[C3](w) {
+		t.Errorf("pools not filled")
+	}
+	w.Destroy()
+}
+
 func TestFilterWithOneIncNested(t *testing.T) {
 	w := ecs.NewWorld()
 	e1 := w.NewEntity()
@@ -0,0 +1,72 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+package ecs // import "leopotam.com/go/ecs"
+
+// NetID is stable entity id for replication between processes, zero value - no id.
+type NetID uint64
+
+// SetEntityNetID links entity with network id, previous id of entity will be removed.
+// Id, used by another entity, raises panic in DEBUG and will be moved to entity in RELEASE.
+// Link will be removed automatically on entity destroying.
+func (w *World) SetEntityNetID(entity int, id NetID) {
+	if DEBUG {
+		if !w.checkEntityAlive(entity) {
+			panic("cant touch destroyed entity")
+		}
+		if id == 0 {
+			panic("invalid network id")
+		}
+		if e, ok := w.netIDs[id]; ok && e != entity {
+			panic("network id already used by another entity")
+		}
+	}
+	if w.netIDs == nil {
+		w.netIDs = make(map[NetID]int)
+		w.entityNetIDs = make(map[int]NetID)
+	}
+	if prev, ok := w.entityNetIDs[entity]; ok {
+		delete(w.netIDs, prev)
+	}
+	// id of another entity will be moved.
+	if owner, ok := w.netIDs[id]; ok && owner != entity {
+		delete(w.entityNetIDs, owner)
+	}
+	w.netIDs[id] = entity
+	w.entityNetIDs[entity] = id
+}
+
+func (w *World) GetEntityNetID(entity int) (NetID, bool) {
+	id, ok := w.entityNetIDs[entity]
+	return id, ok
+}
+
+func (w *World) GetEntityByNetID(id NetID) (int, bool) {
+	entity, ok := w.netIDs[id]
+	return entity, ok
+}
+
+func (w *World) DelEntityNetID(entity int) {
+	if id, ok := w.entityNetIDs[entity]; ok {
+		delete(w.netIDs, id)
+		delete(w.entityNetIDs, entity)
+	}
+}
+
+func (w *World) PackEntityByNetID(id NetID) (PackedEntity, bool) {
+	if entity, ok := w.netIDs[id]; ok {
+		return w.PackEntity(entity), true
+	}
+	return PackedEntity{}, false
+}
+
+// GetPackedEntityNetID returns network id of packed entity, false - entity is dead or has no id.
+func (w *World) GetPackedEntityNetID(pe PackedEntity) (NetID, bool) {
+	entity, ok := pe.Unpack(w)
+	if !ok {
+		return 0, false
+	}
+	return w.GetEntityNetID(entity)
+}
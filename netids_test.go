@@ -0,0 +1,95 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+package ecs_test
+
+import (
+	"testing"
+
+	"leopotam.com/go/ecs"
+)
+
+func TestEntityNetID(t *testing.T) {
+	w := ecs.NewWorld()
+	e := w.NewEntity()
+	ecs.GetPool[C1](w).Add(e)
+	if _, ok := w.GetEntityNetID(e); ok {
+		t.Errorf("entity should not have network id")
+	}
+	w.SetEntityNetID(e, 100)
+	if id, ok := w.GetEntityNetID(e); !ok || id != 100 {
+		t.Errorf("invalid network id: %v", id)
+	}
+	if entity, ok := w.GetEntityByNetID(100); !ok || entity != e {
+		t.Errorf("invalid entity by network id")
+	}
+	w.SetEntityNetID(e, 200)
+	if _, ok := w.GetEntityByNetID(100); ok {
+		t.Errorf("previous network id should be removed")
+	}
+	pe, ok := w.PackEntityByNetID(200)
+	if !ok {
+		t.Fatalf("invalid packed entity by network id")
+	}
+	if id, ok := w.GetPackedEntityNetID(pe); !ok || id != 200 {
+		t.Errorf("invalid network id of packed entity: %v", id)
+	}
+	w.DelEntity(e)
+	if _, ok := w.GetEntityByNetID(200); ok {
+		t.Errorf("network id should be removed with entity")
+	}
+	if _, ok := w.GetPackedEntityNetID(pe); ok {
+		t.Errorf("network id of dead packed entity should be invalid")
+	}
+	// recycled slot should not inherit network id.
+	e2 := w.NewEntity()
+	if _, ok := w.GetEntityNetID(e2); ok {
+		t.Errorf("recycled entity should not have network id")
+	}
+	w.DelEntity(e2)
+	w.Destroy()
+}
+
+func TestInvalidEntityNetIDDuplicate(t *testing.T) {
+	w := ecs.NewWorld()
+	e1 := w.NewEntity()
+	e2 := w.NewEntity()
+	ecs.GetPool[C1](w).Add(e1)
+	ecs.GetPool[C1](w).Add(e2)
+	defer func(world *ecs.World) {
+		if r := recover(); r == nil {
+			t.Errorf("code should panic")
+		}
+		world.Destroy()
+	}(w)
+	w.SetEntityNetID(e1, 1)
+	w.SetEntityNetID(e2, 1)
+	t.Errorf("code should panic")
+}
+
+func TestEntityNetIDMoveRelease(t *testing.T) {
+	if ecs.DEBUG {
+		t.Skip("duplicate network id raises panic in DEBUG")
+	}
+	w := ecs.NewWorld()
+	e1 := w.NewEntity()
+	e2 := w.NewEntity()
+	ecs.GetPool[C1](w).Add(e1)
+	ecs.GetPool[C1](w).Add(e2)
+	w.SetEntityNetID(e1, 1)
+	w.SetEntityNetID(e2, 1)
+	if e, ok := w.GetEntityByNetID(1); !ok || e != e2 {
+		t.Errorf("network id should be moved to new entity")
+	}
+	if _, ok := w.GetEntityNetID(e1); ok {
+		t.Errorf("previous owner should not keep network id")
+	}
+	// removing of previous owner should not touch moved id.
+	w.DelEntity(e1)
+	if e, ok := w.GetEntityByNetID(1); !ok || e != e2 {
+		t.Errorf("moved network id should be kept")
+	}
+	w.Destroy()
+}
@@ -0,0 +1,323 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+// Command ecsdigen generates reflection-free injection methods for ecsdi:
+//
+//	//go:generate go run leopotam.com/go/ecs/pkg/ecsdi/cmd/ecsdigen -type=System1,System2
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const ecsdiPath = "leopotam.com/go/ecs/pkg/ecsdi"
+const defaultOutput = "ecsdi_gen.go"
+
+// injectable types of ecsdi package.
+var ecsdiTypes = map[string]bool{
+	"World":         true,
+	"Pool":          true,
+	"Filter":        true,
+	"FilterWithExc": true,
+	"Query":         true,
+	"EventWriter":   true,
+	"EventReader":   true,
+	"CommandBuffer": true,
+	"CommandPool":   true,
+	"Custom":        true,
+	"Interface":     true,
+}
+
+func main() {
+	types := flag.String("type", "", "comma-separated list of struct types")
+	output := flag.String("output", defaultOutput, "output file name")
+	flag.Parse()
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	if len(*types) == 0 {
+		fmt.Fprintln(os.Stderr, "ecsdigen: -type flag is required")
+		os.Exit(2)
+	}
+	src, err := generateDir(dir, strings.Split(*types, ","), *output)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, *output), src, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ecsdigen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func generateDir(dir string, types []string, output string) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != output
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected one package in \"%s\", found %d", dir, len(pkgs))
+	}
+	for _, pkg := range pkgs {
+		names := make([]string, 0, len(pkg.Files))
+		for name := range pkg.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		files := make([]*ast.File, 0, len(names))
+		for _, name := range names {
+			files = append(files, pkg.Files[name])
+		}
+		return generate(fset, pkg.Name, files, types)
+	}
+	return nil, errors.New("unreachable")
+}
+
+// generate returns formatted source with EcsdiInject() methods for requested types.
+func generate(fset *token.FileSet, pkgName string, files []*ast.File, types []string) ([]byte, error) {
+	resolver := newTypeResolver(fset, pkgName, files)
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by ecsdigen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\nimport \"%s\"\n", pkgName, ecsdiPath)
+	for _, typeName := range types {
+		typeName = strings.TrimSpace(typeName)
+		spec, file := findType(files, typeName)
+		if spec == nil {
+			return nil, fmt.Errorf("type \"%s\" not found", typeName)
+		}
+		if spec.TypeParams != nil && len(spec.TypeParams.List) > 0 {
+			return nil, fmt.Errorf("generic type \"%s\" not supported", typeName)
+		}
+		st, ok := spec.Type.(*ast.StructType)
+		if !ok {
+			return nil, fmt.Errorf("type \"%s\" is not struct", typeName)
+		}
+		if err := generateType(&buf, resolver, pkgName, typeName, st, ecsdiAlias(file)); err != nil {
+			return nil, err
+		}
+	}
+	return format.Source(buf.Bytes())
+}
+
+func findType(files []*ast.File, name string) (*ast.TypeSpec, *ast.File) {
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				if ts := spec.(*ast.TypeSpec); ts.Name.Name == name {
+					return ts, file
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// ecsdiAlias returns name of ecsdi package inside file or empty string if it is not imported.
+func ecsdiAlias(file *ast.File) string {
+	for _, imp := range file.Imports {
+		if path, _ := strconv.Unquote(imp.Path.Value); path == ecsdiPath {
+			if imp.Name != nil {
+				return imp.Name.Name
+			}
+			return "ecsdi"
+		}
+	}
+	return ""
+}
+
+func generateType(buf *bytes.Buffer, resolver *typeResolver, pkgName, typeName string, st *ast.StructType, alias string) error {
+	// same name as reflect.Type.String() for errors of strict mode.
+	owner := pkgName + "." + typeName
+	fmt.Fprintf(buf, "\nfunc (s *%s) EcsdiInject(i *ecsdi.Injector) bool {\n", typeName)
+	buf.WriteString("if !i.Accept(s) {\nreturn false\n}\n")
+	for _, field := range st.Fields.List {
+		rawTag, tagged := "", false
+		if field.Tag != nil {
+			tag, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return err
+			}
+			rawTag, tagged = reflect.StructTag(tag).Lookup("ecsdi")
+		}
+		injectable := isEcsdiType(field.Type, alias)
+		if len(field.Names) == 0 {
+			// embedded field.
+			name := embeddedName(field.Type)
+			if len(name) == 0 {
+				return fmt.Errorf("unsupported embedded field in type \"%s\"", typeName)
+			}
+			if injectable {
+				fmt.Fprintf(buf, "i.InjectField(%q, %q, &s.%s, %q)\n", owner, name, name, rawTag)
+			} else {
+				generateNested(buf, resolver, name, field.Type, tagged)
+			}
+			continue
+		}
+		for _, ident := range field.Names {
+			// only public fields can be injected.
+			if !ident.IsExported() {
+				continue
+			}
+			if injectable {
+				fmt.Fprintf(buf, "i.InjectField(%q, %q, &s.%s, %q)\n", owner, ident.Name, ident.Name, rawTag)
+			} else if tagged {
+				generateNested(buf, resolver, ident.Name, field.Type, true)
+			}
+		}
+	}
+	buf.WriteString("return true\n}\n")
+	return nil
+}
+
+// generateNested writes injection into nested struct field,
+// nil pointer will be created if create is true (same as reflection for tagged fields).
+// Fields of non-struct types are skipped.
+func generateNested(buf *bytes.Buffer, resolver *typeResolver, name string, expr ast.Expr, create bool) {
+	star, ok := expr.(*ast.StarExpr)
+	elem := expr
+	if ok {
+		elem = star.X
+	}
+	if resolver.kind(elem) == kindOther {
+		return
+	}
+	switch {
+	case !ok:
+		fmt.Fprintf(buf, "i.InjectNested(&s.%s)\n", name)
+	case create:
+		fmt.Fprintf(buf, "if s.%s == nil {\ns.%s = new(%s)\n}\n", name, name, types.ExprString(star.X))
+		fmt.Fprintf(buf, "i.InjectNested(s.%s)\n", name)
+	default:
+		fmt.Fprintf(buf, "if s.%s != nil {\ni.InjectNested(s.%s)\n}\n", name, name)
+	}
+}
+
+type typeKind int
+
+const (
+	// Injector.InjectNested() skips values of unresolved types at runtime if they are not structs.
+	kindUnknown typeKind = 0
+	kindStruct  typeKind = 1
+	kindOther   typeKind = 2
+)
+
+type typeResolver struct {
+	files []*ast.File
+	info  *types.Info
+}
+
+func newTypeResolver(fset *token.FileSet, pkgName string, files []*ast.File) *typeResolver {
+	r := &typeResolver{
+		files: files,
+		info:  &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)},
+	}
+	// errors are ignored: generated methods can be used by package code,
+	// types of failed expressions will be resolved with declarations of package files.
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(err error) {},
+	}
+	conf.Check(pkgName, fset, files, r.info)
+	return r
+}
+
+// kind returns kind of type expression with help of type checker,
+// declarations of package files will be used for expressions with invalid types.
+func (r *typeResolver) kind(expr ast.Expr) typeKind {
+	if tv, ok := r.info.Types[expr]; ok && tv.Type != nil && tv.Type != types.Typ[types.Invalid] {
+		if _, ok := tv.Type.Underlying().(*types.Struct); ok {
+			return kindStruct
+		}
+		return kindOther
+	}
+	return r.declKind(expr, 0)
+}
+
+func (r *typeResolver) declKind(expr ast.Expr, depth int) typeKind {
+	// protection from invalid recursive declarations.
+	if depth > 16 {
+		return kindUnknown
+	}
+	switch e := expr.(type) {
+	case *ast.StructType:
+		return kindStruct
+	case *ast.ParenExpr:
+		return r.declKind(e.X, depth+1)
+	case *ast.IndexExpr:
+		return r.declKind(e.X, depth+1)
+	case *ast.IndexListExpr:
+		return r.declKind(e.X, depth+1)
+	case *ast.SelectorExpr:
+		// type of other package.
+		return kindUnknown
+	case *ast.Ident:
+		spec, _ := findType(r.files, e.Name)
+		if spec == nil {
+			// predeclared types.
+			return kindOther
+		}
+		return r.declKind(spec.Type, depth+1)
+	}
+	return kindOther
+}
+
+func isEcsdiType(expr ast.Expr, alias string) bool {
+	if len(alias) == 0 {
+		return false
+	}
+	switch e := expr.(type) {
+	case *ast.IndexExpr:
+		expr = e.X
+	case *ast.IndexListExpr:
+		expr = e.X
+	}
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == alias && ecsdiTypes[sel.Sel.Name]
+}
+
+func embeddedName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch e := expr.(type) {
+	case *ast.IndexExpr:
+		expr = e.X
+	case *ast.IndexListExpr:
+		expr = e.X
+	}
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const testSource = `package systems
+
+import (
+	"fmt"
+
+	"example.com/ext"
+	di "leopotam.com/go/ecs/pkg/ecsdi"
+)
+
+type C1 struct{}
+
+type Base struct {
+	World di.World
+}
+
+type Services struct {
+	Counter int
+}
+
+type System1 struct {
+	Base
+	Pool     di.Pool[C1]
+	Events   di.World ` + "`ecsdi:\"events\"`" + `
+	Custom   di.Custom[Services] ` + "`ecsdi:\"main,optional\"`" + `
+	Nested   *Base ` + "`ecsdi:\"\"`" + `
+	Value    Base ` + "`ecsdi:\"\"`" + `
+	Skipped  Base
+	private  di.World
+	Counter  int
+}
+
+type Alias int
+
+type Handler func()
+
+type Wrapper Base
+
+type System2 struct {
+	fmt.Stringer
+	Alias
+	Counter int ` + "`ecsdi:\"\"`" + `
+	Handler Handler ` + "`ecsdi:\"\"`" + `
+	Ptr     *Alias ` + "`ecsdi:\"\"`" + `
+	Wrapper Wrapper ` + "`ecsdi:\"\"`" + `
+	Service *ext.Service ` + "`ecsdi:\"\"`" + `
+}
+`
+
+func parseTestFile(t *testing.T) (*token.FileSet, []*ast.File) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "systems.go", testSource, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fset, []*ast.File{f}
+}
+
+func TestGenerate(t *testing.T) {
+	fset, files := parseTestFile(t)
+	src, err := generate(fset, "systems", files, []string{"System1", "Base"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+	expected := []string{
+		"// Code generated by ecsdigen. DO NOT EDIT.",
+		"package systems",
+		"func (s *System1) EcsdiInject(i *ecsdi.Injector) bool {",
+		"i.InjectNested(&s.Base)",
+		"i.InjectField(\"systems.System1\", \"Pool\", &s.Pool, \"\")",
+		"i.InjectField(\"systems.System1\", \"Events\", &s.Events, \"events\")",
+		"i.InjectField(\"systems.System1\", \"Custom\", &s.Custom, \"main,optional\")",
+		"s.Nested = new(Base)",
+		"i.InjectNested(s.Nested)",
+		"i.InjectNested(&s.Value)",
+		"func (s *Base) EcsdiInject(i *ecsdi.Injector) bool {",
+		"i.InjectField(\"systems.Base\", \"World\", &s.World, \"\")",
+	}
+	for _, line := range expected {
+		if !strings.Contains(code, line) {
+			t.Errorf("generated code should contain %q:\n%s", line, code)
+		}
+	}
+	for _, line := range []string{"s.Skipped", "s.private", "s.Counter"} {
+		if strings.Contains(code, line) {
+			t.Errorf("generated code should not contain %q:\n%s", line, code)
+		}
+	}
+}
+
+func TestGenerateInvalidTypes(t *testing.T) {
+	fset, files := parseTestFile(t)
+	for _, name := range []string{"Unknown", "Alias"} {
+		if _, err := generate(fset, "systems", files, []string{name}); err == nil {
+			t.Errorf("type \"%s\" should not be generated", name)
+		}
+	}
+}
+
+func TestGenerateNonStructFields(t *testing.T) {
+	fset, files := parseTestFile(t)
+	src, err := generate(fset, "systems", files, []string{"System2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+	expected := []string{
+		"i.InjectNested(&s.Wrapper)",
+		// types of not resolved packages are checked at runtime.
+		"s.Service = new(ext.Service)",
+	}
+	for _, line := range expected {
+		if !strings.Contains(code, line) {
+			t.Errorf("generated code should contain %q:\n%s", line, code)
+		}
+	}
+	for _, line := range []string{"s.Stringer", "s.Alias", "s.Counter", "s.Handler", "s.Ptr"} {
+		if strings.Contains(code, line) {
+			t.Errorf("generated code should not contain %q:\n%s", line, code)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+package ecsdi
+
+import "leopotam.com/go/ecs"
+
+// IDisposable is implemented by registered values, that should be released
+// with owner container.
+type IDisposable interface {
+	Dispose()
+}
+
+// Container holds values for injection, values not found in container
+// will be searched in parent containers.
+type Container struct {
+	parent   *Container
+	injects  []any
+	disposed bool
+}
+
+func NewContainer() *Container {
+	return &Container{}
+}
+
+// Register adds value to container, it can be wrapped with Named() call.
+func (c *Container) Register(value any) *Container {
+	if ecs.DEBUG && c.disposed {
+		panic("cant register value in disposed container")
+	}
+	c.injects = append(c.injects, value)
+	return c
+}
+
+func (c *Container) RegisterNamed(name string, value any) *Container {
+	return c.Register(Named(name, value))
+}
+
+// NewScope returns child container, values of current container will be used as fallback.
+func (c *Container) NewScope() *Container {
+	if ecs.DEBUG && c.disposed {
+		panic("cant create scope of disposed container")
+	}
+	return &Container{parent: c}
+}
+
+func (c *Container) GetParent() *Container {
+	return c.parent
+}
+
+func (c *Container) IsDisposed() bool {
+	return c.disposed
+}
+
+// Dispose calls Dispose() of own registered values in reverse order,
+// values of parent containers will not be touched.
+func (c *Container) Dispose() {
+	if c.disposed {
+		return
+	}
+	c.disposed = true
+	for i := len(c.injects) - 1; i >= 0; i-- {
+		inj := c.injects[i]
+		if named, ok := inj.(*namedInject); ok {
+			inj = named.value
+		}
+		if d, ok := inj.(IDisposable); ok {
+			d.Dispose()
+		}
+		c.injects[i] = nil
+	}
+	c.injects = c.injects[:0]
+}
+
+// findInject returns single inject with required name (empty for non-named values),
+// nearest container with matched values wins. For ambiguous injects first matched value
+// will be returned together with injectAmbiguous result.
+func findInject[T any](c *Container, name string) (T, injectResult) {
+	var result T
+	for ; c != nil; c = c.parent {
+		res := injectNotFound
+		for _, inj := range c.injects {
+			injName := ""
+			if named, ok := inj.(*namedInject); ok {
+				injName = named.name
+				inj = named.value
+			}
+			if injName != name {
+				continue
+			}
+			if casted, ok := inj.(T); ok {
+				if res == injectResolved {
+					return result, injectAmbiguous
+				}
+				result = casted
+				res = injectResolved
+			}
+		}
+		if res != injectNotFound {
+			return result, res
+		}
+	}
+	return result, injectNotFound
+}
+
+type containerListener struct {
+	container *Container
+}
+
+func (l *containerListener) OnSystemAdded(systems ecs.ISystems, system any) {}
+
+func (l *containerListener) OnSystemRemoved(systems ecs.ISystems, system any) {}
+
+func (l *containerListener) OnSystemsDestroyed(systems ecs.ISystems) {
+	l.container.Dispose()
+}
+
+// InjectContainer works like Inject, but values will be taken from container.
+// Scope (container with parent) will be disposed automatically after
+// ISystems.Destroy() call, root container should be disposed manually.
+func InjectContainer(systems ecs.ISystems, c *Container) ecs.ISystems {
+	injectContainer(systems, c, false)
+	return systems
+}
+
+func InjectContainerStrict(systems ecs.ISystems, c *Container) (ecs.ISystems, error) {
+	return systems, injectContainer(systems, c, true)
+}
+
+func injectContainer(systems ecs.ISystems, c *Container, strict bool) error {
+	if ecs.DEBUG && c.disposed {
+		panic("cant inject from disposed container")
+	}
+	err := inject(systems, c, strict)
+	if c.parent != nil {
+		systems.AddEventListener(&containerListener{container: c})
+	}
+	return err
+}
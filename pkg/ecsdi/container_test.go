@@ -0,0 +1,96 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+package ecsdi_test
+
+import (
+	"testing"
+
+	"leopotam.com/go/ecs"
+	"leopotam.com/go/ecs/pkg/ecsdi"
+)
+
+type disposableService struct {
+	ID       int
+	Disposed *[]int
+}
+
+func (d *disposableService) Dispose() {
+	*d.Disposed = append(*d.Disposed, d.ID)
+}
+
+type containerSystem1 struct {
+	Data    ecsdi.Custom[customData]
+	Named   ecsdi.Custom[customData] `ecsdi:"named"`
+	Service ecsdi.Custom[disposableService]
+}
+
+func (cs *containerSystem1) Init(s ecs.ISystems) {}
+
+func TestInjectContainer(t *testing.T) {
+	var disposed []int
+	global := customData{ID: 1}
+	named := customData{ID: 2}
+	scoped := customData{ID: 3}
+	globalService := disposableService{ID: 1, Disposed: &disposed}
+	scopedService := disposableService{ID: 2, Disposed: &disposed}
+	root := ecsdi.NewContainer().
+		Register(&global).
+		RegisterNamed("named", &named).
+		Register(&globalService)
+	scope := root.NewScope().Register(&scoped).Register(&scopedService)
+	if scope.GetParent() != root {
+		t.Errorf("invalid scope parent.")
+	}
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	sys := containerSystem1{}
+	s.Add(&sys)
+	ecsdi.InjectContainer(s, scope).Init()
+	if sys.Data.Value != &scoped || sys.Service.Value != &scopedService {
+		t.Errorf("scope values should override parent ones.")
+	}
+	if sys.Named.Value != &named {
+		t.Errorf("parent values should be used as fallback.")
+	}
+	s.Destroy()
+	if !scope.IsDisposed() || root.IsDisposed() {
+		t.Errorf("only scope should be disposed with systems.")
+	}
+	if len(disposed) != 1 || disposed[0] != 2 {
+		t.Errorf("invalid disposed services: %v", disposed)
+	}
+	root.Dispose()
+	if len(disposed) != 2 || disposed[1] != 1 {
+		t.Errorf("invalid disposed services: %v", disposed)
+	}
+	w.Destroy()
+}
+
+func TestInjectContainerStrict(t *testing.T) {
+	root := ecsdi.NewContainer()
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	s.Add(&containerSystem1{})
+	_, err := ecsdi.InjectContainerStrict(s, root.NewScope())
+	uerr, ok := err.(*ecsdi.UnresolvedError)
+	if !ok || len(uerr.Fields) != 3 {
+		t.Errorf("invalid unresolved error: %v", err)
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestInvalidRegisterInDisposedContainer(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("code should panic")
+		}
+	}()
+	c := ecsdi.NewContainer()
+	c.Dispose()
+	c.Register(&customData{})
+	t.Errorf("code should panic")
+}
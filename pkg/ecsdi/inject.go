@@ -8,37 +8,81 @@ package ecsdi // import "leopotam.com/go/ecs/pkg/ecsdi"
 import (
 	"fmt"
 	"reflect"
+	"strings"
 
 	"leopotam.com/go/ecs"
 )
 
+// fill methods return false if field cant be resolved.
 type iBuiltinInject interface {
-	fill(systems ecs.ISystems, tag string)
+	fill(systems ecs.ISystems, tag string) bool
 }
 type iCustomInject interface {
-	fill(injects []any)
+	fill(c *Container, name string) injectResult
+}
+type iCommandsInject interface {
+	fill(systems ecs.ISystems, tag string, c *Container) bool
+}
+
+type injectResult int
+
+const (
+	injectResolved  injectResult = 0
+	injectNotFound  injectResult = 1
+	injectAmbiguous injectResult = 2
+)
+
+// UnresolvedField describes field, that was not filled by injection.
+type UnresolvedField struct {
+	// Type name of struct with field.
+	Target string
+	Field  string
+	Type   reflect.Type
+	Tag    string
+	// More than one inject matches field.
+	Ambiguous bool
+}
+
+func (f UnresolvedField) String() string {
+	str := fmt.Sprintf("%s.%s (%s, tag \"%s\")", f.Target, f.Field, f.Type.String(), f.Tag)
+	if f.Ambiguous {
+		str += " is ambiguous"
+	}
+	return str
+}
+
+type UnresolvedError struct {
+	Fields []UnresolvedField
+}
+
+func (e *UnresolvedError) Error() string {
+	items := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		items = append(items, f.String())
+	}
+	return fmt.Sprintf("unresolved injections: %s", strings.Join(items, ", "))
 }
 
 type World struct {
 	Value *ecs.World
 }
 
-func (w *World) fill(systems ecs.ISystems, tag string) {
+func (w *World) fill(systems ecs.ISystems, tag string) bool {
 	w.Value = systems.GetWorld(tag)
+	return w.Value != nil
 }
 
 type Pool[T any] struct {
 	Value *ecs.Pool[T]
 }
 
-func (p *Pool[T]) fill(systems ecs.ISystems, tag string) {
+func (p *Pool[T]) fill(systems ecs.ISystems, tag string) bool {
 	w := systems.GetWorld(tag)
-	if ecs.DEBUG {
-		if w == nil {
-			panic(fmt.Sprintf("cant get Filter[%s] from undefined world with name \"%s\"", reflect.TypeOf((*T)(nil)).Elem().String(), tag))
-		}
+	if w == nil {
+		return false
 	}
 	p.Value = ecs.GetPool[T](w)
+	return true
 }
 
 func (p *Pool[T]) NewEntity() (*T, int) {
@@ -52,38 +96,104 @@ type Filter[Inc ecs.IInc] struct {
 }
 
 //lint:ignore U1000 called with reflection
-func (f *Filter[Inc]) fill(systems ecs.ISystems, tag string) {
+func (f *Filter[Inc]) fill(systems ecs.ISystems, tag string) bool {
 	w := systems.GetWorld(tag)
-	if ecs.DEBUG {
-		if w == nil {
-			panic(fmt.Sprintf("cant get Filter[%s] from undefined world with name \"%s\"", reflect.TypeOf((*Inc)(nil)).Elem().String(), tag))
-		}
+	if w == nil {
+		return false
 	}
 	var inc Inc
 	f.Pools = any(inc.FillPools(w)).(*Inc)
 	f.Value = ecs.GetFilter[Inc](w)
+	return true
 }
 
 type FilterWithExc[Inc ecs.IInc, Exc ecs.IExc] struct {
 	Value *ecs.Filter
 	Pools *Inc
+	// ExcPools will be filled only if Exc implements ecs.IExcPools.
+	ExcPools *Exc
 }
 
 //lint:ignore U1000 called with reflection
-func (q *FilterWithExc[Inc, Exc]) fill(systems ecs.ISystems, tag string) {
+func (q *FilterWithExc[Inc, Exc]) fill(systems ecs.ISystems, tag string) bool {
 	w := systems.GetWorld(tag)
-	if ecs.DEBUG {
-		if w == nil {
-			panic(fmt.Sprintf(
-				"cant get QueryWithExc[%s, %s] from undefined world with name \"%s\"",
-				reflect.TypeOf((*Inc)(nil)).Elem().String(),
-				reflect.TypeOf((*Exc)(nil)).Elem().String(),
-				tag))
-		}
+	if w == nil {
+		return false
 	}
 	var inc Inc
 	q.Pools = any(inc.FillPools(w)).(*Inc)
+	q.ExcPools = fillExcPools[Exc](w)
 	q.Value = ecs.GetFilterWithExc[Inc, Exc](w)
+	return true
+}
+
+// Query is filter with typed access to pools of constraints and pools of optional
+// components (Opt), that entities may have. Opt is not used as filter constraint.
+type Query[Inc ecs.IInc, Exc ecs.IExc, Opt ecs.IInc] struct {
+	Value *ecs.Filter
+	Inc   *Inc
+	// Exc will be filled only if Exc implements ecs.IExcPools.
+	Exc *Exc
+	Opt *Opt
+}
+
+//lint:ignore U1000 called with reflection
+func (q *Query[Inc, Exc, Opt]) fill(systems ecs.ISystems, tag string) bool {
+	w := systems.GetWorld(tag)
+	if w == nil {
+		return false
+	}
+	var inc Inc
+	var opt Opt
+	q.Inc = any(inc.FillPools(w)).(*Inc)
+	q.Exc = fillExcPools[Exc](w)
+	q.Opt = any(opt.FillPools(w)).(*Opt)
+	q.Value = ecs.GetFilterWithExc[Inc, Exc](w)
+	return true
+}
+
+func fillExcPools[Exc ecs.IExc](w *ecs.World) *Exc {
+	var exc Exc
+	if p, ok := any(exc).(ecs.IExcPools); ok {
+		return any(p.FillPools(w)).(*Exc)
+	}
+	return nil
+}
+
+type EventWriter[T any] struct {
+	Value *ecs.Events[T]
+}
+
+//lint:ignore U1000 called with reflection
+func (e *EventWriter[T]) fill(systems ecs.ISystems, tag string) bool {
+	w := systems.GetWorld(tag)
+	if w == nil {
+		return false
+	}
+	e.Value = ecs.GetEvents[T](w)
+	return true
+}
+
+func (e *EventWriter[T]) Send(evt T) {
+	e.Value.Send(evt)
+}
+
+type EventReader[T any] struct {
+	Value *ecs.Events[T]
+}
+
+//lint:ignore U1000 called with reflection
+func (e *EventReader[T]) fill(systems ecs.ISystems, tag string) bool {
+	w := systems.GetWorld(tag)
+	if w == nil {
+		return false
+	}
+	e.Value = ecs.GetEvents[T](w)
+	return true
+}
+
+func (e *EventReader[T]) Iter() ecs.EventsIter[T] {
+	return e.Value.Iter()
 }
 
 type Custom[T any] struct {
@@ -91,37 +201,373 @@ type Custom[T any] struct {
 }
 
 //lint:ignore U1000 called with reflection
-func (c *Custom[T]) fill(injects []any) {
-	for _, inj := range injects {
-		if casted, ok := inj.(*T); ok {
-			c.Value = casted
-			break
+func (c *Custom[T]) fill(container *Container, name string) injectResult {
+	value, res := findInject[*T](container, name)
+	// first matched value used for ambiguous injects, ambiguity reported by Injector.
+	if res != injectNotFound {
+		c.Value = value
+	}
+	return res
+}
+
+// Interface is inject of any value, assignable to T (usually interface type).
+type Interface[T any] struct {
+	Value T
+}
+
+//lint:ignore U1000 called with reflection
+func (c *Interface[T]) fill(container *Container, name string) injectResult {
+	value, res := findInject[T](container, name)
+	// first matched value used for ambiguous injects, ambiguity reported by Injector.
+	if res != injectNotFound {
+		c.Value = value
+	}
+	return res
+}
+
+type namedInject struct {
+	name  string
+	value any
+}
+
+// Named wraps value for injection only into fields with same name in "ecsdi" tag:
+// ecsdi.Custom[T] `ecsdi:"name"`.
+func Named(name string, value any) any {
+	return &namedInject{name: name, value: value}
+}
+
+// CommandBuffer contains command buffer from container (or its parents), linked to world with name tag,
+// or command buffer of world itself.
+type CommandBuffer struct {
+	Value *ecs.CommandBuffer
+}
+
+//lint:ignore U1000 called with reflection
+func (b *CommandBuffer) fill(systems ecs.ISystems, tag string, c *Container) bool {
+	b.Value = findCommandBuffer(systems, tag, c)
+	return b.Value != nil
+}
+
+type CommandPool[T any] struct {
+	Value *ecs.CommandPool[T]
+}
+
+//lint:ignore U1000 called with reflection
+func (p *CommandPool[T]) fill(systems ecs.ISystems, tag string, c *Container) bool {
+	if b := findCommandBuffer(systems, tag, c); b != nil {
+		p.Value = ecs.GetCommandPool[T](b)
+		return true
+	}
+	return false
+}
+
+// implemented by wrappers over command buffer, for example ecsmt.IDelayedBuffer.
+type iCommandBufferProvider interface {
+	GetCommandBuffer() *ecs.CommandBuffer
+}
+
+func findCommandBuffer(systems ecs.ISystems, tag string, c *Container) *ecs.CommandBuffer {
+	w := systems.GetWorld(tag)
+	if w == nil {
+		return nil
+	}
+	for ; c != nil; c = c.parent {
+		for _, inj := range c.injects {
+			if named, ok := inj.(*namedInject); ok {
+				inj = named.value
+			}
+			var b *ecs.CommandBuffer
+			switch v := inj.(type) {
+			case *ecs.CommandBuffer:
+				b = v
+			case *ecs.World:
+				// world creates command buffer on request, it should not be touched here.
+				continue
+			case iCommandBufferProvider:
+				b = v.GetCommandBuffer()
+			}
+			if b != nil && b.GetWorld() == w {
+				return b
+			}
 		}
 	}
+	return w.GetCommandBuffer()
+}
+
+// IGeneratedInject is implemented by code, generated with ecsdigen tool,
+// injection into such types will be done without reflection over fields.
+// Method should return false if target was not accepted by Injector.Accept().
+type IGeneratedInject interface {
+	EcsdiInject(i *Injector) bool
+}
+
+type injectListener struct {
+	container *Container
+	strict    bool
+}
+
+func (l *injectListener) OnSystemAdded(systems ecs.ISystems, system any) {
+	inj := newInjector(systems, l.container, l.strict)
+	inj.injectPtr(reflect.ValueOf(system))
+	// there is no way to return error from here, misconfigured system should not be used.
+	if err := inj.getError(); err != nil {
+		panic(err)
+	}
+}
+
+func (l *injectListener) OnSystemRemoved(systems ecs.ISystems, system any) {}
+
+func (l *injectListener) OnSystemsDestroyed(systems ecs.ISystems) {}
+
+// only one listener per systems, last inject call wins.
+func setInjectListener(systems ecs.ISystems, container *Container, strict bool) {
+	for _, l := range systems.GetEventListeners(nil) {
+		if prev, ok := l.(*injectListener); ok {
+			prev.container = container
+			prev.strict = strict
+			return
+		}
+	}
+	systems.AddEventListener(&injectListener{container: container, strict: strict})
 }
 
 func Inject(systems ecs.ISystems, injects ...any) ecs.ISystems {
-	injectsLen := len(injects)
+	inject(systems, &Container{injects: injects}, false)
+	return systems
+}
+
+// InjectStrict works like Inject, but returns error with list of all unresolved
+// fields (not marked as optional) in both DEBUG and RELEASE builds.
+// Unresolved fields of systems, added after this call, will raise panic.
+func InjectStrict(systems ecs.ISystems, injects ...any) (ecs.ISystems, error) {
+	return systems, inject(systems, &Container{injects: injects}, true)
+}
+
+func inject(systems ecs.ISystems, c *Container, strict bool) error {
+	inj := newInjector(systems, c, strict)
 	for _, s := range systems.GetAllSystems() {
-		sType := reflect.TypeOf(s).Elem()
-		sValue := reflect.ValueOf(s)
-		for i := 0; i < sType.NumField(); i++ {
-			fValue := sValue.Elem().Field(i)
-			if fValue.CanAddr() && fValue.CanInterface() {
-				fValuePtr := fValue.Addr().Interface()
-				fType := sType.Field(i)
-				if inj, ok := fValuePtr.(iBuiltinInject); ok {
-					inj.fill(systems, fType.Tag.Get("ecsdi"))
-					continue
-				}
-				if injectsLen > 0 {
-					if inj, ok := fValuePtr.(iCustomInject); ok {
-						inj.fill(injects)
-						continue
-					}
-				}
+		inj.injectPtr(reflect.ValueOf(s))
+	}
+	// systems added / replaced later will be injected automatically.
+	setInjectListener(systems, c, strict)
+	return inj.getError()
+}
+
+// InjectInto injects data into any target (pointer to struct), for example into
+// services and helpers, owned by systems.
+func InjectInto(systems ecs.ISystems, target any, injects ...any) {
+	injectInto(systems, target, injects, false)
+}
+
+func InjectIntoStrict(systems ecs.ISystems, target any, injects ...any) error {
+	return injectInto(systems, target, injects, true)
+}
+
+func injectInto(systems ecs.ISystems, target any, injects []any, strict bool) error {
+	v := reflect.ValueOf(target)
+	if ecs.DEBUG && (v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct) {
+		panic(fmt.Sprintf("cant inject into \"%s\", target should be pointer to struct", reflect.TypeOf(target)))
+	}
+	inj := newInjector(systems, &Container{injects: injects}, strict)
+	inj.injectPtr(v)
+	return inj.getError()
+}
+
+// parseTag returns world name and options from "ecsdi" tag: `ecsdi:"name,optional"`.
+func parseTag(tag string) (string, bool) {
+	name, options, _ := strings.Cut(tag, ",")
+	optional := false
+	for _, opt := range strings.Split(options, ",") {
+		if opt == "optional" {
+			optional = true
+		}
+	}
+	return name, optional
+}
+
+type injectKey struct {
+	addr     uintptr
+	itemType reflect.Type
+}
+
+// Injector holds state of one injection call, exported for generated code only.
+type Injector struct {
+	systems   ecs.ISystems
+	container *Container
+	strict    bool
+	// target pointer (or injectKey for non-exported embedded structs):
+	// true - injection in progress, false - completed.
+	states     map[any]bool
+	unresolved []UnresolvedField
+	current    any
+}
+
+func newInjector(systems ecs.ISystems, c *Container, strict bool) *Injector {
+	return &Injector{systems: systems, container: c, strict: strict, states: make(map[any]bool)}
+}
+
+// Accept checks that generated method was called for requested target,
+// not promoted from embedded struct.
+func (i *Injector) Accept(target any) bool {
+	return target == i.current
+}
+
+// InjectField fills field of owner struct (type name with package), rawTag is value of "ecsdi" tag.
+func (i *Injector) InjectField(owner, field string, fieldPtr any, rawTag string) {
+	i.injectField(owner, field, fieldPtr, rawTag)
+}
+
+// InjectNested injects into nested struct, target should be not nil pointer to struct,
+// other values are skipped.
+func (i *Injector) InjectNested(target any) {
+	// same checks as for nested fields with reflection.
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	g, ok := target.(IGeneratedInject)
+	if !ok {
+		i.injectPtr(reflect.ValueOf(target))
+		return
+	}
+	if !i.beginInject(target) {
+		return
+	}
+	if !i.injectGenerated(target, g) {
+		i.injectStruct(reflect.ValueOf(target).Elem())
+	}
+	i.states[target] = false
+}
+
+func (i *Injector) getError() error {
+	if len(i.unresolved) == 0 {
+		return nil
+	}
+	return &UnresolvedError{Fields: i.unresolved}
+}
+
+func (i *Injector) injectPtr(ptr reflect.Value) {
+	// embedded struct at zero offset has same address as parent, type is required too.
+	var key any = injectKey{addr: ptr.Pointer(), itemType: ptr.Type()}
+	var target any
+	if ptr.CanInterface() {
+		target = ptr.Interface()
+		key = target
+	}
+	if !i.beginInject(key) {
+		return
+	}
+	if g, ok := target.(IGeneratedInject); !ok || !i.injectGenerated(target, g) {
+		i.injectStruct(ptr.Elem())
+	}
+	i.states[key] = false
+}
+
+// beginInject returns false if target already processed.
+func (i *Injector) beginInject(key any) bool {
+	if inProgress, ok := i.states[key]; ok {
+		if ecs.DEBUG && inProgress {
+			name := fmt.Sprintf("%T", key)
+			if k, ok := key.(injectKey); ok {
+				name = k.itemType.String()
 			}
+			panic(fmt.Sprintf("cycle detected at injection into \"%s\"", name))
 		}
+		return false
+	}
+	i.states[key] = true
+	return true
+}
+
+func (i *Injector) injectGenerated(target any, g IGeneratedInject) bool {
+	prev := i.current
+	i.current = target
+	ok := g.EcsdiInject(i)
+	i.current = prev
+	return ok
+}
+
+func (i *Injector) injectStruct(sValue reflect.Value) {
+	sType := sValue.Type()
+	for idx := 0; idx < sType.NumField(); idx++ {
+		fValue := sValue.Field(idx)
+		fType := sType.Field(idx)
+		if !fValue.CanAddr() {
+			continue
+		}
+		if !fValue.CanInterface() {
+			// exported fields of unexported embedded struct still can be injected.
+			if fType.Anonymous {
+				i.injectNested(fValue, false)
+			}
+			continue
+		}
+		rawTag, tagged := fType.Tag.Lookup("ecsdi")
+		if i.injectField(sType.String(), fType.Name, fValue.Addr().Interface(), rawTag) {
+			continue
+		}
+		// nested structs: embedded or marked with "ecsdi" tag.
+		if !tagged && !fType.Anonymous {
+			continue
+		}
+		i.injectNested(fValue, tagged)
+	}
+}
+
+// injectField returns false if field is not injectable type.
+func (i *Injector) injectField(owner, field string, fieldPtr any, rawTag string) bool {
+	tag, optional := parseTag(rawTag)
+	switch inj := fieldPtr.(type) {
+	case iBuiltinInject:
+		if !inj.fill(i.systems, tag) {
+			// undefined world for World field is not error in non-strict mode.
+			_, isWorld := inj.(*World)
+			i.onUnresolved(owner, field, fieldPtr, tag, optional, !isWorld, false)
+		}
+	case iCommandsInject:
+		if !inj.fill(i.systems, tag, i.container) {
+			i.onUnresolved(owner, field, fieldPtr, tag, optional, true, false)
+		}
+	case iCustomInject:
+		if res := inj.fill(i.container, tag); res != injectResolved {
+			i.onUnresolved(owner, field, fieldPtr, tag, optional, false, res == injectAmbiguous)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// onUnresolved collects field in strict mode or raises panic in DEBUG for builtin types / ambiguous injects.
+func (i *Injector) onUnresolved(owner, field string, fieldPtr any, tag string, optional, builtin, ambiguous bool) {
+	if optional && !ambiguous {
+		return
+	}
+	info := UnresolvedField{Target: owner, Field: field, Type: reflect.TypeOf(fieldPtr).Elem(), Tag: tag, Ambiguous: ambiguous}
+	if i.strict {
+		i.unresolved = append(i.unresolved, info)
+		return
+	}
+	if ecs.DEBUG && (builtin || ambiguous) {
+		panic(fmt.Sprintf("cant inject %s", info.String()))
+	}
+}
+
+func (i *Injector) injectNested(fValue reflect.Value, create bool) {
+	switch fValue.Kind() {
+	case reflect.Struct:
+		i.injectPtr(fValue.Addr())
+	case reflect.Pointer:
+		if fValue.Type().Elem().Kind() != reflect.Struct {
+			return
+		}
+		if fValue.IsNil() {
+			if !create || !fValue.CanSet() {
+				return
+			}
+			// tagged nil pointers will be created automatically.
+			fValue.Set(reflect.New(fValue.Type().Elem()))
+		}
+		i.injectPtr(fValue)
 	}
-	return systems
 }
@@ -6,10 +6,14 @@
 package ecsdi_test
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
 	"testing"
 
 	"leopotam.com/go/ecs"
 	"leopotam.com/go/ecs/pkg/ecsdi"
+	"leopotam.com/go/ecs/pkg/ecsmt"
 )
 
 type customData struct {
@@ -49,6 +53,176 @@ type filterSystem4 struct {
 	EventsC1WithoutC2Filter ecsdi.FilterWithExc[ecs.Inc1[c1], ecs.Exc1[c2]] `ecsdi:"events"`
 }
 
+// exclude constraint without access to pools.
+type excNoPools[E1 any] struct{}
+
+func (e excNoPools[E1]) FillExcludes(w *ecs.World, list []int16) []int16 {
+	return append(list, ecs.GetPool[E1](w).GetID())
+}
+
+type querySystem1 struct {
+	C1C2WithoutEvt1 ecsdi.Query[ecs.Inc2[c1, c2], ecs.Exc1[evt1], ecs.Inc1[customData]]
+	C1WithoutC2     ecsdi.Query[ecs.Inc1[c1], excNoPools[c2], ecs.Inc2[evt1, customData]] `ecsdi:"events"`
+}
+
+func (qs *querySystem1) Init(s ecs.ISystems) {}
+
+type evt1 struct {
+	ID int
+}
+
+type eventSystem1 struct {
+	Writer       ecsdi.EventWriter[evt1]
+	Reader       ecsdi.EventReader[evt1]
+	EventsWriter ecsdi.EventWriter[evt1] `ecsdi:"events"`
+}
+
+func (es *eventSystem1) Init(s ecs.ISystems) {}
+
+type commandsSystem1 struct {
+	Buffer       ecsdi.CommandBuffer
+	C1Pool       ecsdi.CommandPool[c1]
+	EventsBuffer ecsdi.CommandBuffer   `ecsdi:"events"`
+	EventsC1Pool ecsdi.CommandPool[c1] `ecsdi:"events"`
+}
+
+func (cs *commandsSystem1) Init(s ecs.ISystems) {}
+
+type undefinedCommandsSystem1 struct {
+	Buffer ecsdi.CommandBuffer `ecsdi:"undefined"`
+}
+
+type nestedService1 struct {
+	World  ecsdi.World
+	C1Pool ecsdi.Pool[c1] `ecsdi:"events"`
+}
+
+type nestedBase1 struct {
+	C1Filter ecsdi.Filter[ecs.Inc1[c1]]
+}
+
+type nestedSystem1 struct {
+	nestedBase1
+	Service  *nestedService1 `ecsdi:""`
+	Service2 nestedService1  `ecsdi:""`
+	Skipped  *nestedService1
+	Data     ecsdi.Custom[customData]
+}
+
+func (ns *nestedSystem1) Init(s ecs.ISystems) {}
+
+type cycleService1 struct {
+	Other *cycleService2 `ecsdi:""`
+}
+
+type cycleService2 struct {
+	Other *cycleService1 `ecsdi:""`
+}
+
+type strictSystem1 struct {
+	World        ecsdi.World
+	EventsWorld  ecsdi.World    `ecsdi:"events"`
+	EventsC1Pool ecsdi.Pool[c1] `ecsdi:"events"`
+	Data         ecsdi.Custom[customData]
+	OptionalData ecsdi.Custom[customData] `ecsdi:",optional"`
+	OptionalPool ecsdi.Pool[c1]           `ecsdi:"events,optional"`
+}
+
+func (ss *strictSystem1) Init(s ecs.ISystems) {}
+
+type logger interface {
+	Log(msg string)
+}
+
+type testLogger struct {
+	Messages []string
+}
+
+func (l *testLogger) Log(msg string) {
+	l.Messages = append(l.Messages, msg)
+}
+
+type namedSystem1 struct {
+	Logger  ecsdi.Interface[logger]
+	Data    ecsdi.Custom[customData]
+	Data1   ecsdi.Custom[customData] `ecsdi:"data1"`
+	Data2   ecsdi.Custom[customData] `ecsdi:"data2"`
+	Logger2 ecsdi.Interface[logger]  `ecsdi:"data2,optional"`
+}
+
+func (ns *namedSystem1) Init(s ecs.ISystems) {}
+
+type ambiguousSystem1 struct {
+	Data ecsdi.Custom[customData]
+}
+
+func (as *ambiguousSystem1) Init(s ecs.ISystems) {}
+
+// same code as ecsdigen produces, with calls counter.
+type generatedService1 struct {
+	World  ecsdi.World
+	C1Pool ecsdi.Pool[c1] `ecsdi:"events"`
+	Calls  int
+}
+
+func (gs *generatedService1) EcsdiInject(i *ecsdi.Injector) bool {
+	if !i.Accept(gs) {
+		return false
+	}
+	gs.Calls++
+	i.InjectField("ecsdi_test.generatedService1", "World", &gs.World, "")
+	i.InjectField("ecsdi_test.generatedService1", "C1Pool", &gs.C1Pool, "events")
+	return true
+}
+
+// EcsdiInject() promoted from embedded service should not be used for whole system.
+type generatedSystem1 struct {
+	generatedService1
+	Service *generatedService1 `ecsdi:""`
+	Data    ecsdi.Custom[customData]
+}
+
+func (gs *generatedSystem1) Init(s ecs.ISystems) {}
+
+type generatedSystem2 struct {
+	Service  *generatedService1 `ecsdi:""`
+	Existing *generatedService1
+	Data     ecsdi.Custom[customData]
+}
+
+func (gs *generatedSystem2) EcsdiInject(i *ecsdi.Injector) bool {
+	if !i.Accept(gs) {
+		return false
+	}
+	if gs.Service == nil {
+		gs.Service = new(generatedService1)
+	}
+	i.InjectNested(gs.Service)
+	i.InjectField("ecsdi_test.generatedSystem2", "Data", &gs.Data, "")
+	return true
+}
+
+func (gs *generatedSystem2) Init(s ecs.ISystems) {}
+
+type generatedSystem3 struct {
+	fmt.Stringer
+	Counter int                `ecsdi:""`
+	Service *generatedService1 `ecsdi:""`
+}
+
+func (gs *generatedSystem3) EcsdiInject(i *ecsdi.Injector) bool {
+	if !i.Accept(gs) {
+		return false
+	}
+	// non-struct values should be skipped.
+	i.InjectNested(&gs.Stringer)
+	i.InjectNested(&gs.Counter)
+	i.InjectNested(gs.Service)
+	return true
+}
+
+func (gs *generatedSystem3) Init(s ecs.ISystems) {}
+
 type customSystem1 struct {
 	Data ecsdi.Custom[customData]
 }
@@ -218,10 +392,51 @@ func TestInjectFilterWithExcPools(t *testing.T) {
 	if sys.C1WithoutC2Filter.Pools == nil || sys.C1WithoutC2Filter.Pools.Inc1 != p {
 		t.Errorf("invalid filter pools inject.")
 	}
+	if sys.C1WithoutC2Filter.ExcPools == nil || sys.C1WithoutC2Filter.ExcPools.Exc1 != ecs.GetPool[c2](w) {
+		t.Errorf("invalid filter exclude pools inject.")
+	}
 	s.Destroy()
 	w.Destroy()
 }
 
+func TestInjectQuery(t *testing.T) {
+	w1 := ecs.NewWorld()
+	w2 := ecs.NewWorld()
+	s := ecs.NewSystems(w1)
+	sys := querySystem1{}
+	s.AddWorld(w2, "events").Add(&sys)
+	ecsdi.Inject(s).Init()
+	q1 := sys.C1C2WithoutEvt1
+	if q1.Value != ecs.GetFilterWithExc[ecs.Inc2[c1, c2], ecs.Exc1[evt1]](w1) {
+		t.Errorf("invalid query filter inject.")
+	}
+	if q1.Inc.Inc1 != ecs.GetPool[c1](w1) || q1.Inc.Inc2 != ecs.GetPool[c2](w1) || q1.Exc.Exc1 != ecs.GetPool[evt1](w1) {
+		t.Errorf("invalid query pools inject.")
+	}
+	if q1.Opt.Inc1 != ecs.GetPool[customData](w1) {
+		t.Errorf("invalid query optional pools inject.")
+	}
+	q2 := sys.C1WithoutC2
+	if q2.Value != ecs.GetFilterWithExc[ecs.Inc1[c1], excNoPools[c2]](w2) || q2.Inc.Inc1 != ecs.GetPool[c1](w2) {
+		t.Errorf("invalid query inject from custom world.")
+	}
+	if q2.Exc != nil {
+		t.Errorf("exclude pools should not be filled without ecs.IExcPools.")
+	}
+	if q2.Opt.Inc1 != ecs.GetPool[evt1](w2) || q2.Opt.Inc2 != ecs.GetPool[customData](w2) {
+		t.Errorf("invalid query optional pools inject from custom world.")
+	}
+	// optional components are not constraints.
+	e := w2.NewEntity()
+	q2.Inc.Inc1.Add(e)
+	if q2.Value.GetEntitiesCount() != 1 {
+		t.Errorf("entity without optional components should be in query.")
+	}
+	s.Destroy()
+	w1.Destroy()
+	w2.Destroy()
+}
+
 func TestInvalidFilterFromUndefinedWorld(t *testing.T) {
 	w := ecs.NewWorld()
 	s := ecs.NewSystems(w)
@@ -267,3 +482,413 @@ func TestInjectCustomData(t *testing.T) {
 	s.Destroy()
 	w.Destroy()
 }
+
+func TestInjectReplacedSystem(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	oldSys := customSystem1{}
+	newSys := customSystem1{}
+	cd := &customData{ID: 1}
+	s.Add(&oldSys)
+	ecsdi.Inject(s, cd).Init()
+	oldSys.Data.Value = nil
+	if err := s.Replace(&oldSys, &newSys); err != nil {
+		t.Errorf("unexpected replace error: %v", err)
+	}
+	if newSys.Data.Value != cd {
+		t.Errorf("invalid custom data inject into replaced system.")
+	}
+	if oldSys.Data.Value != nil {
+		t.Errorf("old system should not be injected again.")
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestInjectTwiceReplacedSystem(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	s.AddWorld(w, "events")
+	oldSys := generatedSystem1{}
+	newSys := generatedSystem1{}
+	s.Add(&oldSys)
+	if _, err := ecsdi.InjectStrict(s, &customData{ID: 1}); err != nil {
+		t.Errorf("unexpected inject error: %v", err)
+	}
+	// previous listener should be replaced, strict mode should not be used for unresolved fields.
+	ecsdi.Inject(s).Init()
+	if len(s.GetEventListeners(nil)) != 1 {
+		t.Errorf("invalid event listeners count: %v", len(s.GetEventListeners(nil)))
+	}
+	if err := s.Replace(&oldSys, &newSys); err != nil {
+		t.Errorf("unexpected replace error: %v", err)
+	}
+	if newSys.Service == nil || newSys.Service.Calls != 1 {
+		t.Errorf("replaced system should be injected once.")
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestInjectEvents(t *testing.T) {
+	w1 := ecs.NewWorld()
+	w2 := ecs.NewWorld()
+	s := ecs.NewSystems(w1)
+	sys := eventSystem1{}
+	s.AddWorld(w2, "events").Add(&sys)
+	ecsdi.Inject(s).Init()
+	if sys.Writer.Value != ecs.GetEvents[evt1](w1) || sys.Reader.Value != sys.Writer.Value {
+		t.Errorf("invalid events inject.")
+	}
+	if sys.EventsWriter.Value != ecs.GetEvents[evt1](w2) {
+		t.Errorf("invalid events from custom world inject.")
+	}
+	sys.Writer.Send(evt1{ID: 1})
+	count := 0
+	for it := sys.Reader.Iter(); it.Next(); {
+		if it.Get().ID == 1 {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("invalid events count.")
+	}
+	s.Destroy()
+	w1.Destroy()
+	w2.Destroy()
+}
+
+func TestInjectCommands(t *testing.T) {
+	w1 := ecs.NewWorld()
+	w2 := ecs.NewWorld()
+	s := ecs.NewSystems(w1)
+	sys := commandsSystem1{}
+	s.AddWorld(w2, "events").Add(&sys)
+	ecsdi.Inject(s).Init()
+	if sys.Buffer.Value != w1.GetCommandBuffer() || sys.EventsBuffer.Value != w2.GetCommandBuffer() {
+		t.Errorf("invalid command buffer inject.")
+	}
+	if sys.C1Pool.Value == nil || sys.C1Pool.Value != ecs.GetCommandPool[c1](w1.GetCommandBuffer()) {
+		t.Errorf("invalid command pool inject.")
+	}
+	if sys.EventsC1Pool.Value == nil || sys.EventsC1Pool.Value != ecs.GetCommandPool[c1](w2.GetCommandBuffer()) {
+		t.Errorf("invalid command pool from custom world inject.")
+	}
+	s.Destroy()
+	w1.Destroy()
+	w2.Destroy()
+}
+
+func TestInjectCommandsFromContainer(t *testing.T) {
+	w1 := ecs.NewWorld()
+	w2 := ecs.NewWorld()
+	b1 := ecs.NewCommandBuffer(w1)
+	b2 := ecsmt.NewDelayedBuffer(w2)
+	s := ecs.NewSystems(w1)
+	sys := commandsSystem1{}
+	s.AddWorld(w2, "events").Add(&sys)
+	ecsdi.Inject(s, w2, b2, b1).Init()
+	if sys.Buffer.Value != b1 || sys.EventsBuffer.Value != b2.GetCommandBuffer() {
+		t.Errorf("invalid command buffer inject.")
+	}
+	if sys.EventsC1Pool.Value == nil || sys.EventsC1Pool.Value != ecs.GetCommandPool[c1](b2.GetCommandBuffer()) {
+		t.Errorf("invalid command pool from delayed buffer inject.")
+	}
+	sys.C1Pool.Value.Add(sys.Buffer.Value.NewEntity(), c1{})
+	ecsmt.GetDelayedPool[c1](b2).Add(b2.NewEntity(), c1{})
+	sys.Buffer.Value.Playback()
+	b2.Process()
+	if ecs.GetFilter[ecs.Inc1[c1]](w1).GetEntitiesCount() != 1 || ecs.GetFilter[ecs.Inc1[c1]](w2).GetEntitiesCount() != 1 {
+		t.Errorf("invalid entities count after playback.")
+	}
+	s.Destroy()
+	w1.Destroy()
+	w2.Destroy()
+}
+
+func TestInvalidCommandBufferWorldNotFound(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	defer func(world *ecs.World, systems ecs.ISystems) {
+		if r := recover(); r == nil {
+			t.Errorf("code should panic.")
+		}
+		systems.Destroy()
+		world.Destroy()
+	}(w, s)
+	s.Add(&undefinedCommandsSystem1{})
+	ecsdi.Inject(s)
+	t.Errorf("code should panic.")
+}
+
+func TestInjectNested(t *testing.T) {
+	w1 := ecs.NewWorld()
+	w2 := ecs.NewWorld()
+	s := ecs.NewSystems(w1)
+	sys := nestedSystem1{}
+	s.AddWorld(w2, "events").Add(&sys)
+	ecsdi.Inject(s).Init()
+	if sys.C1Filter.Value != ecs.GetFilter[ecs.Inc1[c1]](w1) {
+		t.Errorf("invalid embedded struct inject.")
+	}
+	if sys.Service == nil || sys.Service.World.Value != w1 || sys.Service.C1Pool.Value != ecs.GetPool[c1](w2) {
+		t.Errorf("invalid tagged pointer inject.")
+	}
+	if sys.Service2.World.Value != w1 {
+		t.Errorf("invalid tagged struct inject.")
+	}
+	if sys.Skipped != nil {
+		t.Errorf("untagged pointer should be skipped.")
+	}
+	s.Destroy()
+	w1.Destroy()
+	w2.Destroy()
+}
+
+func TestInjectGenerated(t *testing.T) {
+	w1 := ecs.NewWorld()
+	w2 := ecs.NewWorld()
+	s := ecs.NewSystems(w1)
+	data := customData{ID: 1}
+	sys := generatedSystem1{}
+	s.AddWorld(w2, "events").Add(&sys)
+	ecsdi.Inject(s, &data).Init()
+	if sys.Service == nil || sys.Service.Calls != 1 {
+		t.Fatalf("generated inject should be called once.")
+	}
+	if sys.Service.World.Value != w1 || sys.Service.C1Pool.Value != ecs.GetPool[c1](w2) {
+		t.Errorf("invalid generated inject.")
+	}
+	if sys.World.Value != w1 || sys.C1Pool.Value != ecs.GetPool[c1](w2) {
+		t.Errorf("invalid reflection inject of embedded struct.")
+	}
+	if sys.Data.Value != &data {
+		t.Errorf("invalid reflection inject of system with promoted method.")
+	}
+	s.Destroy()
+	w1.Destroy()
+	w2.Destroy()
+}
+
+func TestInjectGeneratedNested(t *testing.T) {
+	w1 := ecs.NewWorld()
+	w2 := ecs.NewWorld()
+	s := ecs.NewSystems(w1)
+	sys := generatedSystem2{}
+	s.AddWorld(w2, "events").Add(&sys)
+	_, err := ecsdi.InjectStrict(s)
+	var unresolvedErr *ecsdi.UnresolvedError
+	if !errors.As(err, &unresolvedErr) || len(unresolvedErr.Fields) != 1 {
+		t.Fatalf("unresolved error expected: %v", err)
+	}
+	// generated code should report same type name as reflection.
+	if f := unresolvedErr.Fields[0]; f.Target != reflect.TypeOf(sys).String() || f.Field != "Data" {
+		t.Errorf("invalid unresolved field info: %v", f)
+	}
+	if sys.Service == nil || sys.Service.Calls != 1 || sys.Service.World.Value != w1 {
+		t.Errorf("invalid generated nested inject.")
+	}
+	if sys.Existing != nil {
+		t.Errorf("untagged pointer should not be created.")
+	}
+	s.Destroy()
+	w1.Destroy()
+	w2.Destroy()
+}
+
+func TestInjectGeneratedNonStruct(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	sys := generatedSystem3{}
+	s.Add(&sys)
+	if _, err := ecsdi.InjectStrict(s); err != nil {
+		t.Errorf("unexpected inject error: %v", err)
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestInjectInto(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	s.AddWorld(w, "events")
+	data := customData{ID: 1}
+	target := nestedSystem1{Service: &nestedService1{}}
+	service := target.Service
+	ecsdi.InjectInto(s, &target, &data)
+	if target.Service != service || service.World.Value != w {
+		t.Errorf("invalid existing pointer inject.")
+	}
+	if target.Data.Value != &data {
+		t.Errorf("invalid custom data inject.")
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestInvalidInjectIntoNonPointer(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	defer func(world *ecs.World, systems ecs.ISystems) {
+		if r := recover(); r == nil {
+			t.Errorf("code should panic.")
+		}
+		systems.Destroy()
+		world.Destroy()
+	}(w, s)
+	ecsdi.InjectInto(s, nestedService1{})
+	t.Errorf("code should panic.")
+}
+
+func TestInvalidInjectCycle(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	defer func(world *ecs.World, systems ecs.ISystems) {
+		if r := recover(); r == nil {
+			t.Errorf("code should panic.")
+		}
+		systems.Destroy()
+		world.Destroy()
+	}(w, s)
+	s1 := &cycleService1{}
+	s1.Other = &cycleService2{Other: s1}
+	ecsdi.InjectInto(s, s1)
+	t.Errorf("code should panic.")
+}
+
+func TestInjectStrict(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	sys := strictSystem1{}
+	s.Add(&sys)
+	_, err := ecsdi.InjectStrict(s)
+	var unresolvedErr *ecsdi.UnresolvedError
+	if !errors.As(err, &unresolvedErr) {
+		t.Fatalf("invalid error: %v", err)
+	}
+	if len(unresolvedErr.Fields) != 3 {
+		t.Fatalf("invalid unresolved fields: %v", err)
+	}
+	fields := []string{"EventsWorld", "EventsC1Pool", "Data"}
+	for i, f := range unresolvedErr.Fields {
+		if f.Field != fields[i] || f.Target != reflect.TypeOf(sys).String() {
+			t.Errorf("invalid unresolved field: %v", f)
+		}
+	}
+	if f := unresolvedErr.Fields[1]; f.Tag != "events" || f.Type != reflect.TypeOf(sys.EventsC1Pool) {
+		t.Errorf("invalid unresolved field info: %v", f)
+	}
+	if sys.World.Value != w {
+		t.Errorf("resolved fields should be filled.")
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestInjectStrictResolved(t *testing.T) {
+	w1 := ecs.NewWorld()
+	w2 := ecs.NewWorld()
+	s := ecs.NewSystems(w1)
+	sys := strictSystem1{}
+	data := customData{}
+	s.AddWorld(w2, "events").Add(&sys)
+	if _, err := ecsdi.InjectStrict(s, &data); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if sys.OptionalData.Value != &data || sys.OptionalPool.Value != ecs.GetPool[c1](w2) {
+		t.Errorf("optional fields should be filled.")
+	}
+	s.Destroy()
+	w1.Destroy()
+	w2.Destroy()
+}
+
+func TestInjectIntoStrict(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	target := nestedService1{}
+	if err := ecsdi.InjectIntoStrict(s, &target); err == nil {
+		t.Errorf("error expected for undefined world.")
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestInjectInterfaceAndNamed(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	sys := namedSystem1{}
+	l := testLogger{}
+	data := customData{ID: 1}
+	data1 := customData{ID: 2}
+	data2 := customData{ID: 3}
+	s.Add(&sys)
+	_, err := ecsdi.InjectStrict(s, ecsdi.Named("data2", &data2), &l, &data, ecsdi.Named("data1", &data1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sys.Logger.Value.Log("test")
+	if len(l.Messages) != 1 {
+		t.Errorf("invalid interface inject.")
+	}
+	if sys.Data.Value != &data || sys.Data1.Value != &data1 || sys.Data2.Value != &data2 {
+		t.Errorf("invalid named inject.")
+	}
+	if sys.Logger2.Value != nil {
+		t.Errorf("named inject should be filled only from values with same name.")
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestInjectAmbiguousStrict(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	sys := ambiguousSystem1{}
+	s.Add(&sys)
+	data1 := customData{ID: 1}
+	_, err := ecsdi.InjectStrict(s, &data1, &customData{ID: 2})
+	var unresolvedErr *ecsdi.UnresolvedError
+	if !errors.As(err, &unresolvedErr) || len(unresolvedErr.Fields) != 1 || !unresolvedErr.Fields[0].Ambiguous {
+		t.Errorf("ambiguous error expected: %v", err)
+	}
+	if sys.Data.Value != &data1 {
+		t.Errorf("ambiguous field should be filled with first matched value.")
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestInjectUnresolvedKeepsValue(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	data := customData{ID: 1}
+	l := testLogger{}
+	sys := namedSystem1{}
+	sys.Data1.Value = &data
+	sys.Logger2.Value = &l
+	s.Add(&sys)
+	if _, err := ecsdi.InjectStrict(s, &l, &customData{}); err == nil {
+		t.Errorf("error expected for unresolved named fields.")
+	}
+	if sys.Data1.Value != &data || sys.Logger2.Value != &l {
+		t.Errorf("unresolved fields should keep previous values.")
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestInvalidInjectAmbiguous(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	defer func(world *ecs.World, systems ecs.ISystems) {
+		if r := recover(); r == nil {
+			t.Errorf("code should panic.")
+		}
+		systems.Destroy()
+		world.Destroy()
+	}(w, s)
+	s.Add(&ambiguousSystem1{})
+	ecsdi.Inject(s, &customData{}, &customData{})
+	t.Errorf("code should panic.")
+}
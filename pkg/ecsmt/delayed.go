@@ -1,61 +1,84 @@
 package ecsmt
 
 import (
+	"reflect"
+	"runtime"
 	"sync"
 
 	"leopotam.com/go/ecs"
 )
 
-type opType int
+// Delayed buffer is ecs.CommandBuffer with worker shards,
+// types below are kept for compatibility.
+
+type DelayedCommand = ecs.CommandType
+
+const (
+	DelayedNewEntity        = ecs.CommandNewEntity
+	DelayedDelEntity        = ecs.CommandDelEntity
+	DelayedAddComponent     = ecs.CommandAddComponent
+	DelayedDelComponent     = ecs.CommandDelComponent
+	DelayedSetComponent     = ecs.CommandSetComponent
+	DelayedReplaceComponent = ecs.CommandReplaceComponent
+	DelayedCopyEntity       = ecs.CommandCopyEntity
+)
+
+type DelayedConflictReason = ecs.CommandConflictReason
 
 const (
-	newEntity    opType = 0
-	delEntity    opType = 1
-	addComponent opType = 2
-	delComponent opType = 3
+	DelayedConflictStaleEntity      = ecs.CommandConflictStaleEntity
+	DelayedConflictUnresolvedEntity = ecs.CommandConflictUnresolvedEntity
+	DelayedConflictComponentExists  = ecs.CommandConflictComponentExists
+	DelayedConflictComponentMissing = ecs.CommandConflictComponentMissing
 )
 
+type DelayedConflict = ecs.CommandConflict
+
+type DelayedResult = ecs.CommandsResult
+
+// DelayedShard records commands of one worker without locking,
+// should not be used from different goroutines at same time.
+type DelayedShard = ecs.CommandShard
+
 const defaultBufferCapacity int = 1024
 const defaultPoolCapacity int = 512
 
-type delayedOp struct {
-	op       opType
-	entity   int
-	gen      int16
-	pool     int
-	poolItem int
+type DelayedBufferConfig struct {
+	Capacity int
+	// Amount of worker shards, should be equal or greater than workers count of scheduler.
+	ShardsCount int
+	// Optional callback for each skipped command.
+	ConflictHandler func(conflict DelayedConflict)
 }
 
 type IDelayedBuffer interface {
 	NewEntity() int
 	DelEntity(entity int)
-	Process()
-	addComponent(entity int, poolID, itemID int)
-	delComponent(entity, poolID int)
+	CopyEntity(srcEntity int) int
+	Resolve(entity int) (int, bool)
+	ResolvePacked(entity int) (ecs.PackedEntity, bool)
+	GetShard(worker, chunk int) *DelayedShard
+	GetShardsCount() int
+	GetWorld() *ecs.World
+	GetCommandBuffer() *ecs.CommandBuffer
+	Process() DelayedResult
 }
 
 type DelayedPool[T any] struct {
-	sync   sync.Mutex
-	buffer IDelayedBuffer
-	world  *ecs.World
-	pool   *ecs.Pool[T]
-	id     int
-	items  []T
+	commands *ecs.CommandPool[T]
+	pool     *ecs.Pool[T]
+	capacity int
 }
 
 type iDelayedPool interface {
-	link(buffer IDelayedBuffer, id int, world *ecs.World)
-	processAdd(entity, itemID int)
-	processDel(entity int)
-	reset()
+	link(buffer *delayedBuffer)
+	getItemType() reflect.Type
 }
 
 type delayedBuffer struct {
-	sync          sync.Mutex
-	world         *ecs.World
-	ops           []delayedOp
-	pools         []iDelayedPool
-	entitiesAdded []int
+	*ecs.CommandBuffer
+	sync        sync.Mutex
+	poolsHashes map[reflect.Type]iDelayedPool
 }
 
 func NewDelayedPool[T any]() *DelayedPool[T] {
@@ -63,143 +86,146 @@ func NewDelayedPool[T any]() *DelayedPool[T] {
 }
 
 func NewDelayedPoolWithCapacity[T any](capacity int) *DelayedPool[T] {
-	return &DelayedPool[T]{items: make([]T, 0, capacity)}
+	return &DelayedPool[T]{capacity: capacity}
 }
 
 func NewDelayedBuffer(world *ecs.World, pools ...iDelayedPool) IDelayedBuffer {
-	return NewDelayedBufferWithCapacity(world, defaultBufferCapacity, pools...)
+	return NewDelayedBufferWithConfig(world, DelayedBufferConfig{}, pools...)
 }
 
 func NewDelayedBufferWithCapacity(world *ecs.World, capacity int, pools ...iDelayedPool) IDelayedBuffer {
-	b := &delayedBuffer{world: world, ops: make([]delayedOp, 0, capacity), pools: pools}
-	for k, v := range pools {
-		v.link(b, k, world)
-	}
-	return b
+	return NewDelayedBufferWithConfig(world, DelayedBufferConfig{Capacity: capacity}, pools...)
 }
 
-func (b *delayedBuffer) NewEntity() int {
-	b.sync.Lock()
-	op := delayedOp{
-		op:     newEntity,
-		entity: -(len(b.entitiesAdded) + 1),
+func NewDelayedBufferWithConfig(world *ecs.World, config DelayedBufferConfig, pools ...iDelayedPool) IDelayedBuffer {
+	if config.Capacity <= 0 {
+		config.Capacity = defaultBufferCapacity
 	}
-	b.entitiesAdded = append(b.entitiesAdded, -1)
-	b.ops = append(b.ops, op)
-	b.sync.Unlock()
-	return op.entity
-}
-
-func (b *delayedBuffer) DelEntity(entity int) {
-	if ecs.DEBUG && entity < 0 {
-		panic("cant delete delayed entity")
+	if config.ShardsCount <= 0 {
+		config.ShardsCount = runtime.NumCPU()
 	}
-	b.sync.Lock()
-	op := delayedOp{
-		op:     delEntity,
-		entity: entity,
-		gen:    b.world.GetEntityGen(entity),
+	b := &delayedBuffer{
+		CommandBuffer: ecs.NewCommandBufferWithConfig(world, ecs.CommandBufferConfig{
+			Capacity:        config.Capacity,
+			ShardsCount:     config.ShardsCount,
+			ConflictHandler: config.ConflictHandler,
+		}),
+		poolsHashes: make(map[reflect.Type]iDelayedPool, len(pools)),
 	}
-	b.ops = append(b.ops, op)
-	b.sync.Unlock()
+	for _, v := range pools {
+		v.link(b)
+		if _, ok := b.poolsHashes[v.getItemType()]; !ok {
+			b.poolsHashes[v.getItemType()] = v
+		}
+	}
+	return b
 }
 
-func (b *delayedBuffer) Process() {
+// GetDelayedPool returns delayed pool of buffer for component type, it will be created on first call.
+// Creation of pool can touch world, it should not be done inside tasks for new component types.
+func GetDelayedPool[T any](buffer IDelayedBuffer) *DelayedPool[T] {
+	b := buffer.(*delayedBuffer)
+	itemType := reflect.TypeOf((*T)(nil))
 	b.sync.Lock()
 	defer b.sync.Unlock()
-	for _, v := range b.ops {
-		switch v.op {
-		case newEntity:
-			b.entitiesAdded[-(v.entity + 1)] = b.world.NewEntity()
-		case delEntity:
-			if ecs.DEBUG && b.world.GetEntityGen(v.entity) != v.gen {
-				panic("cant delete non-exist entity")
-			}
-			b.world.DelEntity(v.entity)
-		case addComponent:
-			if v.entity < 0 {
-				v.entity = b.entitiesAdded[-(v.entity + 1)]
-			}
-			b.pools[v.pool].processAdd(v.entity, v.poolItem)
-		case delComponent:
-			b.pools[v.pool].processDel(v.entity)
-		}
+	if p, ok := b.poolsHashes[itemType]; ok {
+		return p.(*DelayedPool[T])
 	}
-	b.ops = b.ops[:0]
-	b.entitiesAdded = b.entitiesAdded[:0]
-	for _, v := range b.pools {
-		v.reset()
+	p := NewDelayedPool[T]()
+	p.link(b)
+	b.poolsHashes[itemType] = p
+	return p
+}
+
+func (b *delayedBuffer) GetCommandBuffer() *ecs.CommandBuffer {
+	return b.CommandBuffer
+}
+
+func (b *delayedBuffer) ResolvePacked(entity int) (ecs.PackedEntity, bool) {
+	if entity, ok := b.Resolve(entity); ok {
+		return b.GetWorld().PackEntity(entity), true
 	}
+	return ecs.PackedEntity{}, false
 }
 
-func (b *delayedBuffer) addComponent(entity int, poolID, itemID int) {
-	op := delayedOp{
-		op:       addComponent,
-		entity:   entity,
-		pool:     poolID,
-		poolItem: itemID,
+// Process applies all recorded commands. Commands for destroyed / recycled entities
+// and conflicted component commands will be skipped and reported to ConflictHandler.
+func (b *delayedBuffer) Process() DelayedResult {
+	return b.PlaybackWithResult()
+}
+
+func (p *DelayedPool[T]) link(buffer *delayedBuffer) {
+	if ecs.DEBUG && p.commands != nil {
+		panic("already attached to buffer")
 	}
-	b.sync.Lock()
-	b.ops = append(b.ops, op)
-	b.sync.Unlock()
+	p.commands = ecs.GetCommandPoolWithCapacity[T](buffer.CommandBuffer, p.capacity)
+	p.pool = ecs.GetPool[T](buffer.GetWorld())
+}
+
+func (p *DelayedPool[T]) getItemType() reflect.Type {
+	return reflect.TypeOf((*T)(nil))
 }
 
-func (b *delayedBuffer) delComponent(entity, poolID int) {
-	op := delayedOp{
-		op:     delComponent,
-		entity: entity,
-		pool:   poolID,
+func (p *DelayedPool[T]) Add(entity int, v T) {
+	if ecs.DEBUG && p.commands == nil {
+		panic("not linked with buffer")
 	}
-	b.sync.Lock()
-	b.ops = append(b.ops, op)
-	b.sync.Unlock()
+	p.commands.Add(entity, v)
 }
 
-func (p *DelayedPool[T]) link(buffer IDelayedBuffer, id int, world *ecs.World) {
-	if ecs.DEBUG && p.buffer != nil {
-		panic("already attached to buffer")
+func (p *DelayedPool[T]) ShardAdd(shard *DelayedShard, entity int, v T) {
+	if ecs.DEBUG && p.commands == nil {
+		panic("not linked with buffer")
 	}
-	p.buffer = buffer
-	p.id = id
-	p.world = world
-	p.pool = ecs.GetPool[T](world)
+	p.commands.ShardAdd(shard, entity, v)
 }
 
-func (p *DelayedPool[T]) processAdd(entity, itemID int) {
-	*p.pool.Add(entity) = p.items[itemID]
+// Set overwrites value of existing component.
+func (p *DelayedPool[T]) Set(entity int, v T) {
+	if ecs.DEBUG && p.commands == nil {
+		panic("not linked with buffer")
+	}
+	p.commands.Set(entity, v)
 }
 
-func (p *DelayedPool[T]) processDel(entity int) {
-	p.pool.Del(entity)
+func (p *DelayedPool[T]) ShardSet(shard *DelayedShard, entity int, v T) {
+	if ecs.DEBUG && p.commands == nil {
+		panic("not linked with buffer")
+	}
+	p.commands.ShardSet(shard, entity, v)
 }
 
-func (p *DelayedPool[T]) reset() {
-	p.items = p.items[:0]
+// Replace adds component or overwrites value of existing one.
+func (p *DelayedPool[T]) Replace(entity int, v T) {
+	if ecs.DEBUG && p.commands == nil {
+		panic("not linked with buffer")
+	}
+	p.commands.Replace(entity, v)
 }
 
-func (p *DelayedPool[T]) Add(entity int, v T) {
-	if ecs.DEBUG && p.buffer == nil {
+func (p *DelayedPool[T]) ShardReplace(shard *DelayedShard, entity int, v T) {
+	if ecs.DEBUG && p.commands == nil {
 		panic("not linked with buffer")
 	}
-	p.sync.Lock()
-	itemID := len(p.items)
-	p.items = append(p.items, v)
-	p.sync.Unlock()
-	p.buffer.addComponent(entity, p.id, itemID)
+	p.commands.ShardReplace(shard, entity, v)
 }
 
 func (p *DelayedPool[T]) Del(entity int) {
-	if ecs.DEBUG && p.buffer == nil {
+	if ecs.DEBUG && p.commands == nil {
 		panic("not linked with buffer")
 	}
-	if ecs.DEBUG && entity < 0 {
-		panic("cant delete delayed component")
+	p.commands.Del(entity)
+}
+
+func (p *DelayedPool[T]) ShardDel(shard *DelayedShard, entity int) {
+	if ecs.DEBUG && p.commands == nil {
+		panic("not linked with buffer")
 	}
-	p.buffer.delComponent(entity, p.id)
+	p.commands.ShardDel(shard, entity)
 }
 
 func (p *DelayedPool[T]) Get(entity int) *T {
-	if ecs.DEBUG && p.buffer == nil {
+	if ecs.DEBUG && p.pool == nil {
 		panic("not linked with buffer")
 	}
 	if ecs.DEBUG && entity < 0 {
@@ -209,7 +235,7 @@ func (p *DelayedPool[T]) Get(entity int) *T {
 }
 
 func (p *DelayedPool[T]) Has(entity int) bool {
-	if ecs.DEBUG && p.buffer == nil {
+	if ecs.DEBUG && p.pool == nil {
 		panic("not linked with buffer")
 	}
 	if ecs.DEBUG && entity < 0 {
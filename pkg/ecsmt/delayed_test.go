@@ -6,6 +6,7 @@
 package ecsmt_test
 
 import (
+	"context"
 	"testing"
 
 	"leopotam.com/go/ecs"
@@ -113,6 +114,19 @@ func (s *delayedHasComponentSystem) Process(entities []int, from, before int) {
 	}
 }
 
+type delayedShardTask struct {
+	buffer ecsmt.IDelayedBuffer
+	pool   *ecsmt.DelayedPool[c1]
+}
+
+func (t *delayedShardTask) Process(ctx context.Context, worker int, entities []int, from, before int) error {
+	shard := t.buffer.GetShard(worker, from)
+	for i := from; i < before; i++ {
+		t.pool.ShardAdd(shard, shard.NewEntity(), c1{counter: i})
+	}
+	return nil
+}
+
 func TestDelayedDefault(t *testing.T) {
 	w := ecs.NewWorld()
 	s := ecs.NewSystems(w)
@@ -298,25 +312,304 @@ func TestDelayedInvalidBufferDelEntityDelayed(t *testing.T) {
 	t.Errorf("code should panic.")
 }
 
-func TestDelayedInvalidBufferDoubleDelEntity(t *testing.T) {
+func TestDelayedDoubleDelEntity(t *testing.T) {
 	w := ecs.NewWorld()
-	defer func(world *ecs.World) {
-		if r := recover(); r == nil {
-			t.Errorf("code should panic.")
-		}
-		world.Destroy()
-	}(w)
 	f := ecs.GetFilter[ecs.Inc1[c1]](w)
 	p := ecsmt.NewDelayedPool[c1]()
 	b := ecsmt.NewDelayedBuffer(w, p)
 	p.Add(b.NewEntity(), c1{})
-	b.Process()
+	if res := b.Process(); res.Applied != 2 || res.Skipped != 0 {
+		t.Errorf("invalid process result: %+v", res)
+	}
 	if f.GetEntitiesCount() != 1 {
-		return
+		t.Fatalf("invalid entities count: %v", f.GetEntitiesCount())
 	}
 	e := f.GetRawEntities()[0]
 	b.DelEntity(e)
 	b.DelEntity(e)
+	if res := b.Process(); res.Applied != 1 || res.Skipped != 1 {
+		t.Errorf("invalid process result: %+v", res)
+	}
+	w.Destroy()
+}
+
+func TestDelayedConflicts(t *testing.T) {
+	w := ecs.NewWorld()
+	pool := ecs.GetPool[c1](w)
+	var conflicts []ecsmt.DelayedConflict
+	p := ecsmt.NewDelayedPool[c1]()
+	b := ecsmt.NewDelayedBufferWithConfig(w, ecsmt.DelayedBufferConfig{
+		ShardsCount: 2,
+		ConflictHandler: func(conflict ecsmt.DelayedConflict) {
+			conflicts = append(conflicts, conflict)
+		},
+	}, p)
+	e1 := w.NewEntity()
+	pool.Add(e1)
+	e2 := w.NewEntity()
+	pool.Add(e2)
+	// worker 0 deletes entity, worker 1 adds component to it later.
+	b.GetShard(0, 0).DelEntity(e1)
+	p.ShardSet(b.GetShard(1, 10), e1, c1{counter: 1})
+	// component already exists.
+	p.Add(e2, c1{counter: 2})
+	// component missing after deletion.
+	p.Del(e2)
+	p.Set(e2, c1{counter: 3})
+	// delayed entity from another shard used before creation.
+	delayed := b.GetShard(1, 20).NewEntity()
+	p.ShardAdd(b.GetShard(0, 0), delayed, c1{})
+	res := b.Process()
+	if res.Applied != 3 || res.Skipped != 4 {
+		t.Errorf("invalid process result: %+v", res)
+	}
+	expected := []ecsmt.DelayedConflict{
+		{Command: ecsmt.DelayedSetComponent, Entity: e1, Reason: ecsmt.DelayedConflictStaleEntity},
+		{Command: ecsmt.DelayedAddComponent, Entity: e2, Reason: ecsmt.DelayedConflictComponentExists},
+		{Command: ecsmt.DelayedSetComponent, Entity: e2, Reason: ecsmt.DelayedConflictStaleEntity},
+		{Command: ecsmt.DelayedAddComponent, Entity: delayed, Reason: ecsmt.DelayedConflictUnresolvedEntity},
+	}
+	if len(conflicts) != len(expected) {
+		t.Fatalf("invalid conflicts count: %v", len(conflicts))
+	}
+	for i, c := range conflicts {
+		if c != expected[i] {
+			t.Errorf("invalid conflict at %v: %+v", i, c)
+		}
+	}
+	// delayed entity was created without components.
+	if e, ok := b.Resolve(delayed); ok {
+		w.DelEntity(e)
+	}
+	w.Destroy()
+}
+
+func TestDelayedShards(t *testing.T) {
+	for _, mode := range []ecsmt.SchedulerMode{ecsmt.SchedulerModeStatic, ecsmt.SchedulerModeDynamic} {
+		scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 4, Mode: mode})
+		w := ecs.NewWorld()
+		p := ecs.GetPool[c1](w)
+		f := ecs.GetFilter[ecs.Inc1[c1]](w)
+		for i := 0; i < 1000; i++ {
+			p.Add(w.NewEntity())
+		}
+		pool := ecsmt.NewDelayedPool[c1]()
+		b := ecsmt.NewDelayedBufferWithConfig(w, ecsmt.DelayedBufferConfig{ShardsCount: scheduler.GetWorkersCount()}, pool)
+		if b.GetShardsCount() != 4 {
+			t.Errorf("invalid shards count: %v", b.GetShardsCount())
+		}
+		task := &delayedShardTask{buffer: b, pool: pool}
+		if err := scheduler.RunTaskCtx(context.Background(), task, f, 7); err != nil {
+			t.Errorf("unexpected task error: %v", err)
+		}
+		b.Process()
+		if f.GetEntitiesCount() != 2000 {
+			t.Errorf("invalid entities count after process: %v", f.GetEntitiesCount())
+		}
+		// new entities should be created in order of chunks, not workers.
+		for i := 0; i < 1000; i++ {
+			if c := p.Get(1000 + i).counter; c != i {
+				t.Errorf("invalid component order: %v != %v", c, i)
+				break
+			}
+		}
+		w.Destroy()
+		scheduler.Close()
+	}
+}
+
+func TestDelayedShardsWithShared(t *testing.T) {
+	w := ecs.NewWorld()
+	p := ecs.GetPool[c1](w)
+	pool := ecsmt.NewDelayedPool[c1]()
+	b := ecsmt.NewDelayedBufferWithConfig(w, ecsmt.DelayedBufferConfig{ShardsCount: 2}, pool)
+	// shared commands keep recording order relative to sharded ones.
+	pool.Add(b.NewEntity(), c1{counter: 1})
+	shard := b.GetShard(1, 10)
+	pool.ShardAdd(shard, shard.NewEntity(), c1{counter: 3})
+	shard = b.GetShard(0, 0)
+	pool.ShardAdd(shard, shard.NewEntity(), c1{counter: 2})
+	pool.Add(b.NewEntity(), c1{counter: 4})
+	shard = b.GetShard(1, 0)
+	pool.ShardAdd(shard, shard.NewEntity(), c1{counter: 5})
 	b.Process()
+	for i := 0; i < 5; i++ {
+		if p.Get(i).counter != i+1 {
+			t.Errorf("invalid component order at %v: %v", i, p.Get(i).counter)
+		}
+	}
+	// buffer should be reusable after process.
+	shard = b.GetShard(0, 0)
+	pool.ShardAdd(shard, shard.NewEntity(), c1{counter: 6})
+	b.Process()
+	if p.Get(5).counter != 6 {
+		t.Errorf("invalid component after second process: %v", p.Get(5).counter)
+	}
+	pool.ShardDel(b.GetShard(1, 0), 0)
+	b.Process()
+	if f := ecs.GetFilter[ecs.Inc1[c1]](w); f.GetEntitiesCount() != 5 {
+		t.Errorf("invalid entities count after del: %v", f.GetEntitiesCount())
+	}
+	w.Destroy()
+}
+
+func TestDelayedSharedEntityInShard(t *testing.T) {
+	w := ecs.NewWorld()
+	p := ecs.GetPool[c1](w)
+	pool := ecsmt.NewDelayedPool[c1]()
+	b := ecsmt.NewDelayedBufferWithConfig(w, ecsmt.DelayedBufferConfig{ShardsCount: 2}, pool)
+	e := b.NewEntity()
+	pool.ShardAdd(b.GetShard(0, 0), e, c1{counter: 1})
+	pool.ShardAdd(b.GetShard(1, 0), e, c1{counter: 2})
+	if res := b.Process(); res.Applied != 2 || res.Skipped != 1 {
+		t.Errorf("invalid process result: %+v", res)
+	}
+	if e, ok := b.Resolve(e); !ok || p.Get(e).counter != 1 {
+		t.Errorf("invalid delayed entity")
+	}
+	w.Destroy()
+}
+
+func TestDelayedStaleDelayedEntity(t *testing.T) {
+	w := ecs.NewWorld()
+	var conflicts []ecsmt.DelayedConflict
+	pool := ecsmt.NewDelayedPool[c1]()
+	b := ecsmt.NewDelayedBufferWithConfig(w, ecsmt.DelayedBufferConfig{
+		ShardsCount: 2,
+		ConflictHandler: func(conflict ecsmt.DelayedConflict) {
+			conflicts = append(conflicts, conflict)
+		},
+	}, pool)
+	old1 := b.NewEntity()
+	old2 := b.NewEntity()
+	pool.Add(old1, c1{})
+	pool.Add(old2, c1{})
+	b.Process()
+	// delayed entities of previous cycle should not be resolved with new entities.
+	pool.Add(b.NewEntity(), c1{})
+	pool.Add(b.NewEntity(), c1{})
+	pool.Add(old1, c1{})
+	// out of range index.
+	pool.Add(-1000, c1{})
+	if res := b.Process(); res.Applied != 4 || res.Skipped != 2 {
+		t.Errorf("invalid process result: %+v", res)
+	}
+	for _, c := range conflicts {
+		if c.Reason != ecsmt.DelayedConflictUnresolvedEntity {
+			t.Errorf("invalid conflict: %+v", c)
+		}
+	}
+	if _, ok := b.Resolve(old2); ok {
+		t.Errorf("delayed entity of previous cycle should not be resolved")
+	}
+	if _, ok := b.Resolve(-1000); ok {
+		t.Errorf("out of range delayed entity should not be resolved")
+	}
+	w.Destroy()
+}
+
+func TestDelayedInvalidShardWorker(t *testing.T) {
+	w := ecs.NewWorld()
+	defer func(world *ecs.World) {
+		if r := recover(); r == nil {
+			t.Errorf("code should panic.")
+		}
+		world.Destroy()
+	}(w)
+	b := ecsmt.NewDelayedBufferWithConfig(w, ecsmt.DelayedBufferConfig{ShardsCount: 2})
+	b.GetShard(2, 0)
 	t.Errorf("code should panic.")
 }
+
+func TestDelayedSetReplace(t *testing.T) {
+	w := ecs.NewWorld()
+	p := ecs.GetPool[c1](w)
+	pool := ecsmt.NewDelayedPool[c1]()
+	b := ecsmt.NewDelayedBuffer(w, pool)
+	e := w.NewEntity()
+	p.Add(e).counter = 1
+	pool.Set(e, c1{counter: 2})
+	b.Process()
+	if p.Get(e).counter != 2 {
+		t.Errorf("invalid component after set: %v", p.Get(e).counter)
+	}
+	pool.Replace(e, c1{counter: 3})
+	e2 := b.NewEntity()
+	pool.Replace(e2, c1{counter: 4})
+	b.Process()
+	if p.Get(e).counter != 3 {
+		t.Errorf("invalid component after replace: %v", p.Get(e).counter)
+	}
+	if e2, ok := b.Resolve(e2); !ok || p.Get(e2).counter != 4 {
+		t.Errorf("invalid component after replace on delayed entity")
+	}
+	shard := b.GetShard(0, 0)
+	pool.ShardSet(shard, e, c1{counter: 5})
+	b.Process()
+	if p.Get(e).counter != 5 {
+		t.Errorf("invalid component after shard set: %v", p.Get(e).counter)
+	}
+	w.Destroy()
+}
+
+func TestDelayedCopyEntity(t *testing.T) {
+	w := ecs.NewWorld()
+	p := ecs.GetPool[c1](w)
+	pool := ecsmt.NewDelayedPool[c1]()
+	b := ecsmt.NewDelayedBuffer(w, pool)
+	src := w.NewEntity()
+	p.Add(src).counter = 1
+	dst := b.CopyEntity(src)
+	if _, ok := b.Resolve(dst); ok {
+		t.Errorf("delayed entity should not be resolved before process")
+	}
+	// copy of delayed entity.
+	e := b.NewEntity()
+	pool.Add(e, c1{counter: 2})
+	dst2 := b.CopyEntity(e)
+	b.Process()
+	dstEntity, ok := b.Resolve(dst)
+	if !ok || dstEntity == src || p.Get(dstEntity).counter != 1 {
+		t.Errorf("invalid copied entity")
+	}
+	if dst2Entity, ok := b.Resolve(dst2); !ok || p.Get(dst2Entity).counter != 2 {
+		t.Errorf("invalid copy of delayed entity")
+	}
+	packed, ok := b.ResolvePacked(dst)
+	if !ok {
+		t.Errorf("cant resolve packed entity")
+	}
+	if unpacked, ok := packed.Unpack(w); !ok || unpacked != dstEntity {
+		t.Errorf("invalid packed entity")
+	}
+	if resolved, ok := b.Resolve(src); !ok || resolved != src {
+		t.Errorf("non-delayed entity should be resolved as is")
+	}
+	w.Destroy()
+}
+
+func TestDelayedGetPool(t *testing.T) {
+	w := ecs.NewWorld()
+	explicit := ecsmt.NewDelayedPool[c1]()
+	b := ecsmt.NewDelayedBuffer(w, explicit)
+	if ecsmt.GetDelayedPool[c1](b) != explicit {
+		t.Errorf("explicit pool should be returned by type")
+	}
+	type c2 struct{ id int }
+	p2 := ecsmt.GetDelayedPool[c2](b)
+	if ecsmt.GetDelayedPool[c2](b) != p2 {
+		t.Errorf("pool should be same instance")
+	}
+	e := b.NewEntity()
+	p2.Add(e, c2{id: 1})
+	explicit.Add(e, c1{})
+	b.Process()
+	entity, _ := b.Resolve(e)
+	if ecs.GetPool[c2](w).Get(entity).id != 1 || !ecs.GetPool[c1](w).Has(entity) {
+		t.Errorf("invalid components after process")
+	}
+	if b.GetWorld() != w {
+		t.Errorf("invalid world")
+	}
+	w.Destroy()
+}
@@ -0,0 +1,54 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+package ecsmt
+
+import "leopotam.com/go/ecs"
+
+// cache line size padding to prevent false sharing between workers.
+const workerSlotPadding int = 64
+
+type workerSlot[T any] struct {
+	value T
+	_     [workerSlotPadding]byte
+}
+
+type WorkerStorage[T any] struct {
+	slots []workerSlot[T]
+}
+
+func NewWorkerStorage[T any](scheduler *Scheduler) *WorkerStorage[T] {
+	ws := &WorkerStorage[T]{slots: make([]workerSlot[T], scheduler.GetWorkersCount())}
+	ws.Reset()
+	return ws
+}
+
+func (ws *WorkerStorage[T]) Get(worker int) *T {
+	return &ws.slots[worker].value
+}
+
+func (ws *WorkerStorage[T]) GetCount() int {
+	return len(ws.slots)
+}
+
+// Reset sets all worker values to default state
+// (ecs.IComponentReset will be used if implemented).
+func (ws *WorkerStorage[T]) Reset() {
+	var defaultT T
+	for i := range ws.slots {
+		if r, ok := any(&ws.slots[i].value).(ecs.IComponentReset); ok {
+			r.Reset()
+		} else {
+			ws.slots[i].value = defaultT
+		}
+	}
+}
+
+// Reduce merges all worker values into dst, should be called after task completion.
+func (ws *WorkerStorage[T]) Reduce(dst *T, fn func(dst, item *T)) {
+	for i := range ws.slots {
+		fn(dst, &ws.slots[i].value)
+	}
+}
@@ -0,0 +1,99 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+package ecsmt_test
+
+import (
+	"context"
+	"testing"
+
+	"leopotam.com/go/ecs"
+	"leopotam.com/go/ecs/pkg/ecsmt"
+)
+
+type sumData struct {
+	sum     int
+	visited []int
+}
+
+func (d *sumData) Reset() {
+	d.sum = 0
+	d.visited = d.visited[:0]
+}
+
+type sumTask struct {
+	pool    *ecs.Pool[c1]
+	storage *ecsmt.WorkerStorage[sumData]
+}
+
+func (t *sumTask) Process(ctx context.Context, worker int, entities []int, from, before int) error {
+	data := t.storage.Get(worker)
+	for i := from; i < before; i++ {
+		data.sum += t.pool.Get(entities[i]).counter
+		data.visited = append(data.visited, entities[i])
+	}
+	return nil
+}
+
+type sumWorkerTask struct {
+	pool    *ecs.Pool[c1]
+	storage *ecsmt.WorkerStorage[sumData]
+}
+
+func (t *sumWorkerTask) Process(worker int, entities []int, from, before int) {
+	data := t.storage.Get(worker)
+	for i := from; i < before; i++ {
+		data.sum += t.pool.Get(entities[i]).counter
+	}
+}
+
+func TestWorkerStorage(t *testing.T) {
+	scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 4, Mode: ecsmt.SchedulerModeDynamic})
+	w, f, p := newCtxTaskWorld(100)
+	for i, e := range f.GetRawEntities() {
+		p.Get(e).counter = i + 1
+	}
+	task := &sumTask{pool: p, storage: ecsmt.NewWorkerStorage[sumData](scheduler)}
+	if task.storage.GetCount() != 4 {
+		t.Errorf("invalid worker storage size: %v", task.storage.GetCount())
+	}
+	for i := 0; i < 2; i++ {
+		task.storage.Reset()
+		if err := scheduler.RunTaskCtx(context.Background(), task, f, 7); err != nil {
+			t.Errorf("unexpected task error: %v", err)
+		}
+		var result sumData
+		task.storage.Reduce(&result, func(dst, item *sumData) {
+			dst.sum += item.sum
+			dst.visited = append(dst.visited, item.visited...)
+		})
+		if result.sum != 5050 || len(result.visited) != 100 {
+			t.Errorf("invalid reduce result: %v, %v", result.sum, len(result.visited))
+		}
+	}
+	w.Destroy()
+	scheduler.Close()
+}
+
+func TestWorkerStorageWithWorkerTask(t *testing.T) {
+	for _, mode := range []ecsmt.SchedulerMode{ecsmt.SchedulerModeStatic, ecsmt.SchedulerModeDynamic} {
+		scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 4, Mode: mode})
+		w, f, p := newCtxTaskWorld(100)
+		for i, e := range f.GetRawEntities() {
+			p.Get(e).counter = i + 1
+		}
+		task := &sumWorkerTask{pool: p, storage: ecsmt.NewWorkerStorage[sumData](scheduler)}
+		scheduler.RunTaskWorker(task, f, 7)
+		var result sumData
+		task.storage.Reduce(&result, func(dst, item *sumData) {
+			dst.sum += item.sum
+		})
+		if result.sum != 5050 {
+			t.Errorf("invalid reduce result in mode %v: %v", mode, result.sum)
+		}
+		w.Destroy()
+		scheduler.Close()
+	}
+}
@@ -6,18 +6,20 @@
 package ecsmt
 
 import (
+	"context"
+	"fmt"
 	"runtime"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 
 	"leopotam.com/go/ecs"
 )
 
 type worker struct {
 	id          int
-	proc        func(worker *worker)
 	workPresent chan struct{}
 	workDone    chan struct{}
-	entities    []int
 	from        int
 	before      int
 }
@@ -26,71 +28,358 @@ type ITask interface {
 	Process(entities []int, from, before int)
 }
 
-var workers []*worker
-var task ITask
-var runSync sync.Mutex
+// ITaskWorker works like ITask, but gets index of scheduler worker,
+// can be used with WorkerStorage.
+type ITaskWorker interface {
+	Process(worker int, entities []int, from, before int)
+}
 
-func workerProc(worker *worker) {
-	for {
-		<-worker.workPresent
-		task.Process(worker.entities, worker.from, worker.before)
-		worker.entities = nil
-		worker.workDone <- struct{}{}
+type ITaskCtx interface {
+	Process(ctx context.Context, worker int, entities []int, from, before int) error
+}
+
+// ISource is range of entities for task processing, *ecs.Filter implements it.
+// GetEntitiesCount() always called before GetRawEntities().
+type ISource interface {
+	GetEntitiesCount() int
+	GetRawEntities() []int
+}
+
+// Entities is user defined list of entities for task processing.
+type Entities []int
+
+func (e Entities) GetEntitiesCount() int {
+	return len(e)
+}
+
+func (e Entities) GetRawEntities() []int {
+	return e
+}
+
+// IndexRange is range of indices [0, IndexRange) for task processing,
+// task will get nil as entities list and should use indices directly.
+type IndexRange int
+
+func (r IndexRange) GetEntitiesCount() int {
+	return int(r)
+}
+
+func (r IndexRange) GetRawEntities() []int {
+	return nil
+}
+
+// PoolSource is list of entities with component from pool.
+type PoolSource struct {
+	pool     ecs.IPool
+	entities []int
+}
+
+func NewPoolSource(pool ecs.IPool) *PoolSource {
+	return &PoolSource{pool: pool}
+}
+
+func (s *PoolSource) GetEntitiesCount() int {
+	s.entities = s.pool.GetEntities(s.entities[:0])
+	return len(s.entities)
+}
+
+func (s *PoolSource) GetRawEntities() []int {
+	return s.entities
+}
+
+type TaskPanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *TaskPanicError) Error() string {
+	return fmt.Sprintf("panic inside task: %v", e.Value)
+}
+
+type SchedulerMode int
+
+const (
+	// Entities will be split to equal contiguous ranges, one range per worker.
+	SchedulerModeStatic SchedulerMode = 0
+	// Workers will pull chunkSize-sized ranges from shared cursor until all entities will be processed.
+	SchedulerModeDynamic SchedulerMode = 1
+)
+
+type SchedulerConfig struct {
+	WorkersCount int
+	Mode         SchedulerMode
+}
+
+type Scheduler struct {
+	// should be first field for 64-bit alignment of atomic operations.
+	cursor     int64
+	failed     int32
+	sync       sync.Mutex
+	config     SchedulerConfig
+	workers    []*worker
+	task       ITask
+	taskWorker ITaskWorker
+	taskCtx    ITaskCtx
+	ctx        context.Context
+	entities   []int
+	count      int
+	chunkSize  int
+	errSync    sync.Mutex
+	err        error
+	closed     bool
+	wg         sync.WaitGroup
+}
+
+var defaultScheduler *Scheduler
+var defaultSchedulerOnce sync.Once
+
+func NewScheduler() *Scheduler {
+	return NewSchedulerWithConfig(SchedulerConfig{})
+}
+
+func NewSchedulerWithConfig(config SchedulerConfig) *Scheduler {
+	if config.WorkersCount <= 0 {
+		config.WorkersCount = runtime.NumCPU()
 	}
+	s := &Scheduler{config: config}
+	s.workers = make([]*worker, 0, config.WorkersCount)
+	for i := 0; i < config.WorkersCount; i++ {
+		w := &worker{
+			id:          i,
+			workPresent: make(chan struct{}),
+			workDone:    make(chan struct{}),
+		}
+		s.workers = append(s.workers, w)
+		s.wg.Add(1)
+		go s.workerProc(w)
+	}
+	return s
 }
 
-func RunTask(newTask ITask, filter *ecs.Filter, chunkSize int) {
-	runSync.Lock()
-	defer runSync.Unlock()
-	count := filter.GetEntitiesCount()
-	if count <= 0 {
+// GetDefaultScheduler returns scheduler used by package-level RunTask(),
+// it will be created on first call with runtime.NumCPU() workers.
+func GetDefaultScheduler() *Scheduler {
+	defaultSchedulerOnce.Do(func() {
+		defaultScheduler = NewScheduler()
+	})
+	return defaultScheduler
+}
+
+func RunTask(newTask ITask, source ISource, chunkSize int) {
+	GetDefaultScheduler().RunTask(newTask, source, chunkSize)
+}
+
+func RunTaskWorker(newTask ITaskWorker, source ISource, chunkSize int) {
+	GetDefaultScheduler().RunTaskWorker(newTask, source, chunkSize)
+}
+
+func RunTaskCtx(ctx context.Context, newTask ITaskCtx, source ISource, chunkSize int) error {
+	return GetDefaultScheduler().RunTaskCtx(ctx, newTask, source, chunkSize)
+}
+
+func (s *Scheduler) GetWorkersCount() int {
+	return len(s.workers)
+}
+
+func (s *Scheduler) Close() {
+	s.sync.Lock()
+	defer s.sync.Unlock()
+	if s.closed {
 		return
 	}
+	s.closed = true
+	for _, w := range s.workers {
+		close(w.workPresent)
+	}
+	s.wg.Wait()
+}
+
+// RunTask processes source entities on scheduler workers.
+// Panic inside any worker will be raised again at caller side as *TaskPanicError.
+func (s *Scheduler) RunTask(newTask ITask, source ISource, chunkSize int) {
+	s.sync.Lock()
+	defer s.sync.Unlock()
+	s.task = newTask
+	err := s.run(source, chunkSize)
+	s.task = nil
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RunTaskWorker works like RunTask, but passes index of worker to task.
+func (s *Scheduler) RunTaskWorker(newTask ITaskWorker, source ISource, chunkSize int) {
+	s.sync.Lock()
+	defer s.sync.Unlock()
+	s.taskWorker = newTask
+	err := s.run(source, chunkSize)
+	s.taskWorker = nil
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RunTaskCtx processes source entities on scheduler workers and returns first error / panic
+// of task. Not started chunks will be skipped after error or ctx cancellation.
+func (s *Scheduler) RunTaskCtx(ctx context.Context, newTask ITaskCtx, source ISource, chunkSize int) error {
+	s.sync.Lock()
+	defer s.sync.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.taskCtx = newTask
+	s.ctx = ctx
+	err := s.run(source, chunkSize)
+	s.taskCtx = nil
+	s.ctx = nil
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+func (s *Scheduler) run(source ISource, chunkSize int) error {
+	if ecs.DEBUG && s.closed {
+		panic("cant run task on closed scheduler")
+	}
+	count := source.GetEntitiesCount()
+	if count <= 0 {
+		return nil
+	}
 	if chunkSize <= 0 {
 		chunkSize = 1
 	}
-	maxWorkers := len(workers)
-	if maxWorkers == 0 {
-		for i := 0; i < runtime.NumCPU(); i++ {
-			w := &worker{
-				id:          i,
-				proc:        workerProc,
-				workPresent: make(chan struct{}),
-				workDone:    make(chan struct{}),
-			}
-			workers = append(workers, w)
-			maxWorkers++
-			go w.proc(w)
-		}
+	s.entities = source.GetRawEntities()
+	s.count = count
+	s.chunkSize = chunkSize
+	s.err = nil
+	s.failed = 0
+	var workersCount int
+	if s.config.Mode == SchedulerModeDynamic {
+		workersCount = s.prepareDynamic()
+	} else {
+		workersCount = s.prepareStatic()
+	}
+	for _, v := range s.workers[:workersCount] {
+		v.workPresent <- struct{}{}
 	}
-	task = newTask
+	for _, v := range s.workers[:workersCount] {
+		<-v.workDone
+	}
+	s.entities = nil
+	err := s.err
+	s.err = nil
+	return err
+}
+
+func (s *Scheduler) prepareStatic() int {
+	maxWorkers := len(s.workers)
 	processed := 0
-	jobSize := count / maxWorkers
-	entities := filter.GetRawEntities()
+	jobSize := s.count / maxWorkers
 	var workersCount int
-	if jobSize >= chunkSize {
+	if jobSize >= s.chunkSize {
 		workersCount = maxWorkers
 	} else {
-		workersCount = count / chunkSize
-		jobSize = chunkSize
+		workersCount = s.count / s.chunkSize
+		jobSize = s.chunkSize
 	}
 	if workersCount <= 0 {
 		workersCount = 1
 	}
-	for _, v := range workers[:workersCount-1] {
-		v.entities = entities
+	for _, v := range s.workers[:workersCount-1] {
 		v.from = processed
 		processed += jobSize
 		v.before = processed
-		v.workPresent <- struct{}{}
 	}
-	lastWorker := workers[workersCount-1]
-	lastWorker.entities = entities
+	lastWorker := s.workers[workersCount-1]
 	lastWorker.from = processed
-	lastWorker.before = count
-	lastWorker.workPresent <- struct{}{}
-	for _, v := range workers[:workersCount] {
-		<-v.workDone
+	lastWorker.before = s.count
+	return workersCount
+}
+
+func (s *Scheduler) prepareDynamic() int {
+	workersCount := (s.count + s.chunkSize - 1) / s.chunkSize
+	if workersCount > len(s.workers) {
+		workersCount = len(s.workers)
+	}
+	s.cursor = 0
+	return workersCount
+}
+
+func (s *Scheduler) workerProc(worker *worker) {
+	defer s.wg.Done()
+	for range worker.workPresent {
+		s.process(worker)
+		worker.workDone <- struct{}{}
+	}
+}
+
+func (s *Scheduler) process(worker *worker) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.setError(&TaskPanicError{Value: r, Stack: debug.Stack()})
+		}
+	}()
+	if s.config.Mode == SchedulerModeDynamic {
+		s.processDynamic(worker)
+	} else {
+		s.processRange(worker, worker.from, worker.before)
+	}
+}
+
+func (s *Scheduler) processDynamic(worker *worker) {
+	chunkSize := int64(s.chunkSize)
+	count := int64(s.count)
+	for {
+		from := atomic.AddInt64(&s.cursor, chunkSize) - chunkSize
+		if from >= count {
+			return
+		}
+		before := from + chunkSize
+		if before > count {
+			before = count
+		}
+		if !s.processRange(worker, int(from), int(before)) {
+			return
+		}
+	}
+}
+
+func (s *Scheduler) processRange(worker *worker, from, before int) bool {
+	if s.task != nil || s.taskWorker != nil {
+		if atomic.LoadInt32(&s.failed) != 0 {
+			return false
+		}
+		if s.task != nil {
+			s.task.Process(s.entities, from, before)
+		} else {
+			s.taskWorker.Process(worker.id, s.entities, from, before)
+		}
+		return true
+	}
+	// context tasks processed by chunks for faster cancellation.
+	for from < before {
+		if atomic.LoadInt32(&s.failed) != 0 || s.ctx.Err() != nil {
+			return false
+		}
+		chunkBefore := from + s.chunkSize
+		if chunkBefore > before {
+			chunkBefore = before
+		}
+		if err := s.taskCtx.Process(s.ctx, worker.id, s.entities, from, chunkBefore); err != nil {
+			s.setError(err)
+			return false
+		}
+		from = chunkBefore
+	}
+	return true
+}
+
+func (s *Scheduler) setError(err error) {
+	s.errSync.Lock()
+	if s.err == nil {
+		s.err = err
 	}
-	task = nil
+	s.errSync.Unlock()
+	atomic.StoreInt32(&s.failed, 1)
 }
@@ -6,6 +6,9 @@
 package ecsmt_test
 
 import (
+	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
 
 	"leopotam.com/go/ecs"
@@ -21,6 +24,8 @@ type taskSystem struct {
 	entities  int
 	chunkSize int
 	payload   int
+	skewed    bool
+	scheduler *ecsmt.Scheduler
 	World     ecsdi.World
 	Filter    ecsdi.Filter[ecs.Inc1[c1]]
 	C1Pool    ecsdi.Pool[c1]
@@ -41,13 +46,22 @@ func (s *taskSystem) Init(systems ecs.ISystems) {
 }
 
 func (s *taskSystem) Run(systems ecs.ISystems) {
+	if s.scheduler != nil {
+		s.scheduler.RunTask(s, s.Filter.Value, s.chunkSize)
+		return
+	}
 	ecsmt.RunTask(s, s.Filter.Value, s.chunkSize)
 }
 
 func (s *taskSystem) Process(entities []int, from, before int) {
 	for i := from; i < before; i++ {
 		c1 := s.Filter.Pools.Inc1.Get(entities[i])
-		for i := 0; i < s.payload; i++ {
+		payload := s.payload
+		if s.skewed && i < len(entities)/8 {
+			// first entities are much more expensive to process.
+			payload *= 50
+		}
+		for i := 0; i < payload; i++ {
 			c1.counter = (c1.counter + 1) % 10000
 		}
 	}
@@ -97,6 +111,311 @@ func TestTaskSmallData(t *testing.T) {
 	w.Destroy()
 }
 
+func TestTaskScheduler(t *testing.T) {
+	scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 3})
+	if scheduler.GetWorkersCount() != 3 {
+		t.Errorf("invalid workers count: %v", scheduler.GetWorkersCount())
+	}
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	sys := &taskSystem{entities: 100, chunkSize: 5, payload: 1, scheduler: scheduler}
+	s.Add(sys)
+	ecsdi.Inject(s)
+	s.Init()
+	s.Run()
+	for it := sys.Filter.Value.Iter(); it.Next(); {
+		if sys.C1Pool.Value.Get(it.GetEntity()).counter != 1 {
+			t.Errorf("invalid entity processing")
+		}
+	}
+	s.Destroy()
+	w.Destroy()
+	scheduler.Close()
+	scheduler.Close()
+}
+
+func TestTaskDynamicScheduler(t *testing.T) {
+	for _, data := range [][2]int{{100, 7}, {10, 50}, {3, 1}, {0, 5}, {100, 0}} {
+		scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 4, Mode: ecsmt.SchedulerModeDynamic})
+		w := ecs.NewWorld()
+		s := ecs.NewSystems(w)
+		sys := &taskSystem{entities: data[0], chunkSize: data[1], payload: 1, scheduler: scheduler}
+		s.Add(sys)
+		ecsdi.Inject(s)
+		s.Init()
+		s.Run()
+		for it := sys.Filter.Value.Iter(); it.Next(); {
+			if sys.C1Pool.Value.Get(it.GetEntity()).counter != 1 {
+				t.Errorf("invalid entity processing for %v entities and %v chunk", data[0], data[1])
+			}
+		}
+		s.Destroy()
+		w.Destroy()
+		scheduler.Close()
+	}
+}
+
+func TestTaskSchedulersParallel(t *testing.T) {
+	s1 := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 2})
+	s2 := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 2})
+	done := make(chan struct{})
+	for _, scheduler := range []*ecsmt.Scheduler{s1, s2} {
+		go func(scheduler *ecsmt.Scheduler) {
+			w := ecs.NewWorld()
+			s := ecs.NewSystems(w)
+			s.Add(&taskSystem{entities: 100, chunkSize: 10, payload: 1, scheduler: scheduler})
+			ecsdi.Inject(s)
+			s.Init()
+			for i := 0; i < 10; i++ {
+				s.Run()
+			}
+			s.Destroy()
+			w.Destroy()
+			done <- struct{}{}
+		}(scheduler)
+	}
+	<-done
+	<-done
+	s1.Close()
+	s2.Close()
+}
+
+func TestTaskClosedScheduler(t *testing.T) {
+	scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 1})
+	scheduler.Close()
+	w := ecs.NewWorld()
+	defer func(world *ecs.World) {
+		if r := recover(); r == nil {
+			t.Errorf("code should panic.")
+		}
+		world.Destroy()
+	}(w)
+	f := ecs.GetFilter[ecs.Inc1[c1]](w)
+	ecs.GetPool[c1](w).Add(w.NewEntity())
+	scheduler.RunTask(&taskSystem{}, f, 1)
+	t.Errorf("code should panic.")
+}
+
+func TestTaskDefaultScheduler(t *testing.T) {
+	if ecsmt.GetDefaultScheduler() != ecsmt.GetDefaultScheduler() {
+		t.Errorf("invalid default scheduler.")
+	}
+}
+
+type ctxTask struct {
+	pool      *ecs.Pool[c1]
+	failAt    int
+	panicAt   int
+	cancelAt  int
+	cancel    context.CancelFunc
+	processed int64
+}
+
+var errTaskFailed = errors.New("task failed")
+
+func (t *ctxTask) Process(ctx context.Context, worker int, entities []int, from, before int) error {
+	for i := from; i < before; i++ {
+		if i == t.failAt {
+			return errTaskFailed
+		}
+		if i == t.panicAt {
+			panic("task panic")
+		}
+		if i == t.cancelAt {
+			t.cancel()
+		}
+		t.pool.Get(entities[i]).counter++
+		atomic.AddInt64(&t.processed, 1)
+	}
+	return nil
+}
+
+func newCtxTaskWorld(entities int) (*ecs.World, *ecs.Filter, *ecs.Pool[c1]) {
+	w := ecs.NewWorld()
+	p := ecs.GetPool[c1](w)
+	f := ecs.GetFilter[ecs.Inc1[c1]](w)
+	for i := 0; i < entities; i++ {
+		p.Add(w.NewEntity())
+	}
+	return w, f, p
+}
+
+func TestTaskCtx(t *testing.T) {
+	for _, mode := range []ecsmt.SchedulerMode{ecsmt.SchedulerModeStatic, ecsmt.SchedulerModeDynamic} {
+		scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 2, Mode: mode})
+		w, f, p := newCtxTaskWorld(100)
+		task := &ctxTask{pool: p, failAt: -1, panicAt: -1, cancelAt: -1}
+		if err := scheduler.RunTaskCtx(context.Background(), task, f, 10); err != nil {
+			t.Errorf("unexpected task error: %v", err)
+		}
+		if task.processed != 100 {
+			t.Errorf("invalid processed entities: %v", task.processed)
+		}
+		w.Destroy()
+		scheduler.Close()
+	}
+}
+
+func TestTaskCtxError(t *testing.T) {
+	for _, mode := range []ecsmt.SchedulerMode{ecsmt.SchedulerModeStatic, ecsmt.SchedulerModeDynamic} {
+		scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 1, Mode: mode})
+		w, f, p := newCtxTaskWorld(100)
+		task := &ctxTask{pool: p, failAt: 15, panicAt: -1, cancelAt: -1}
+		if err := scheduler.RunTaskCtx(context.Background(), task, f, 10); !errors.Is(err, errTaskFailed) {
+			t.Errorf("invalid task error: %v", err)
+		}
+		if task.processed != 15 {
+			t.Errorf("remaining chunks should be skipped: %v", task.processed)
+		}
+		w.Destroy()
+		scheduler.Close()
+	}
+}
+
+func TestTaskCtxPanic(t *testing.T) {
+	scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 2})
+	w, f, p := newCtxTaskWorld(100)
+	task := &ctxTask{pool: p, failAt: -1, panicAt: 50, cancelAt: -1}
+	err := scheduler.RunTaskCtx(context.Background(), task, f, 10)
+	var panicErr *ecsmt.TaskPanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "task panic" || len(panicErr.Stack) == 0 {
+		t.Errorf("invalid task error: %v", err)
+	}
+	// scheduler should be usable after panic.
+	task = &ctxTask{pool: p, failAt: -1, panicAt: -1, cancelAt: -1}
+	if err := scheduler.RunTaskCtx(context.Background(), task, f, 10); err != nil {
+		t.Errorf("unexpected task error: %v", err)
+	}
+	w.Destroy()
+	scheduler.Close()
+}
+
+func TestTaskCtxCancel(t *testing.T) {
+	scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 1})
+	w, f, p := newCtxTaskWorld(100)
+	ctx, cancel := context.WithCancel(context.Background())
+	task := &ctxTask{pool: p, failAt: -1, panicAt: -1, cancelAt: 25, cancel: cancel}
+	if err := scheduler.RunTaskCtx(ctx, task, f, 10); !errors.Is(err, context.Canceled) {
+		t.Errorf("invalid task error: %v", err)
+	}
+	if task.processed != 30 {
+		t.Errorf("remaining chunks should be skipped: %v", task.processed)
+	}
+	task.processed = 0
+	if err := scheduler.RunTaskCtx(ctx, task, f, 10); !errors.Is(err, context.Canceled) || task.processed != 0 {
+		t.Errorf("cancelled task should not be started: %v", err)
+	}
+	w.Destroy()
+	scheduler.Close()
+}
+
+type indexTask struct {
+	cells []int
+}
+
+func (t *indexTask) Process(entities []int, from, before int) {
+	for i := from; i < before; i++ {
+		t.cells[i]++
+	}
+}
+
+type entitiesTask struct {
+	pool *ecs.Pool[c1]
+}
+
+func (t *entitiesTask) Process(entities []int, from, before int) {
+	for i := from; i < before; i++ {
+		t.pool.Get(entities[i]).counter++
+	}
+}
+
+func TestTaskIndexRange(t *testing.T) {
+	scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 3})
+	task := &indexTask{cells: make([]int, 100)}
+	scheduler.RunTask(task, ecsmt.IndexRange(len(task.cells)), 10)
+	for i, v := range task.cells {
+		if v != 1 {
+			t.Errorf("invalid cell %v processing: %v", i, v)
+		}
+	}
+	scheduler.Close()
+}
+
+func TestTaskEntities(t *testing.T) {
+	scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 3})
+	w, f, p := newCtxTaskWorld(100)
+	entities := ecsmt.Entities(f.GetRawEntities()[:50])
+	scheduler.RunTask(&entitiesTask{pool: p}, entities, 10)
+	for i, e := range f.GetRawEntities() {
+		if expected := 1 - i/50; p.Get(e).counter != expected {
+			t.Errorf("invalid entity %v processing", e)
+		}
+	}
+	w.Destroy()
+	scheduler.Close()
+}
+
+func TestTaskPoolSource(t *testing.T) {
+	scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 3, Mode: ecsmt.SchedulerModeDynamic})
+	w, f, p := newCtxTaskWorld(100)
+	removed := f.GetRawEntities()[10]
+	p.Del(removed)
+	source := ecsmt.NewPoolSource(p)
+	scheduler.RunTask(&entitiesTask{pool: p}, source, 10)
+	if len(source.GetRawEntities()) != 99 {
+		t.Errorf("invalid pool source entities: %v", len(source.GetRawEntities()))
+	}
+	for _, e := range f.GetRawEntities() {
+		if p.Get(e).counter != 1 {
+			t.Errorf("invalid entity %v processing", e)
+		}
+	}
+	w.Destroy()
+	scheduler.Close()
+}
+
+type panicTask struct{}
+
+func (t *panicTask) Process(entities []int, from, before int) {
+	panic("task panic")
+}
+
+func TestTaskPanic(t *testing.T) {
+	scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 2})
+	w, f, _ := newCtxTaskWorld(10)
+	defer func(world *ecs.World, scheduler *ecsmt.Scheduler) {
+		r := recover()
+		if panicErr, ok := r.(*ecsmt.TaskPanicError); !ok || panicErr.Value != "task panic" {
+			t.Errorf("invalid panic: %v", r)
+		}
+		world.Destroy()
+		scheduler.Close()
+	}(w, scheduler)
+	scheduler.RunTask(&panicTask{}, f, 1)
+	t.Errorf("code should panic.")
+}
+
+type panicWorkerTask struct{}
+
+func (t *panicWorkerTask) Process(worker int, entities []int, from, before int) {
+	panic("task panic")
+}
+
+func TestTaskWorkerPanic(t *testing.T) {
+	scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{WorkersCount: 2})
+	w, f, _ := newCtxTaskWorld(10)
+	defer func(world *ecs.World, scheduler *ecsmt.Scheduler) {
+		r := recover()
+		if panicErr, ok := r.(*ecsmt.TaskPanicError); !ok || panicErr.Value != "task panic" {
+			t.Errorf("invalid panic: %v", r)
+		}
+		world.Destroy()
+		scheduler.Close()
+	}(w, scheduler)
+	scheduler.RunTaskWorker(&panicWorkerTask{}, f, 1)
+	t.Errorf("code should panic.")
+}
+
 func BenchmarkWorkers(b *testing.B) {
 	w := ecs.NewWorld()
 	s := ecs.NewSystems(w)
@@ -112,3 +431,29 @@ func BenchmarkWorkers(b *testing.B) {
 	s.Destroy()
 	w.Destroy()
 }
+
+func benchmarkSkewedWorkers(b *testing.B, mode ecsmt.SchedulerMode, chunkSize int) {
+	scheduler := ecsmt.NewSchedulerWithConfig(ecsmt.SchedulerConfig{Mode: mode})
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	s.Add(&taskSystem{entities: 10000, chunkSize: chunkSize, payload: 100, skewed: true, scheduler: scheduler})
+	ecsdi.Inject(s)
+	s.Init()
+	s.Run()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Run()
+	}
+	b.StopTimer()
+	s.Destroy()
+	w.Destroy()
+	scheduler.Close()
+}
+
+func BenchmarkWorkersSkewedStatic(b *testing.B) {
+	benchmarkSkewedWorkers(b, ecsmt.SchedulerModeStatic, 100)
+}
+
+func BenchmarkWorkersSkewedDynamic(b *testing.B) {
+	benchmarkSkewedWorkers(b, ecsmt.SchedulerModeDynamic, 100)
+}
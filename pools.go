@@ -25,6 +25,7 @@ type IPool interface {
 	Has(entity int) bool
 	Del(entity int)
 	GetSparseIndices() []int
+	GetEntities(list []int) []int
 	GetRaw(entity int) any
 	GetItemType() reflect.Type
 	Copy(srcEntity, dstEntity int)
@@ -35,8 +36,11 @@ type Pool[T any] struct {
 	world           *World
 	itemType        reflect.Type
 	items           []T
+	denseEntities   []int
 	sparseIndices   []int
 	recycledIndices []int
+	// component is EntityRef[].
+	refs bool
 }
 
 func newPool[T any](world *World, id int16, denseCapacity int, sparseCapacity int, recycledCapacity int) *Pool[T] {
@@ -45,8 +49,11 @@ func newPool[T any](world *World, id int16, denseCapacity int, sparseCapacity in
 	p.world = world
 	p.itemType = reflect.TypeOf(p.items).Elem()
 	p.items = make([]T, 1, denseCapacity+1)
+	p.denseEntities = make([]int, 1, denseCapacity+1)
+	p.denseEntities[0] = -1
 	p.sparseIndices = make([]int, sparseCapacity)
 	p.recycledIndices = make([]int, 0, denseCapacity+1)
+	_, p.refs = any(&p.items[0]).(iEntityRef)
 	return p
 }
 
@@ -70,9 +77,11 @@ func (p *Pool[T]) Add(entity int) *T {
 			r.Reset()
 		}
 		p.items = append(p.items, defaultT)
+		p.denseEntities = append(p.denseEntities, entity)
 	} else {
 		denseIdx = p.recycledIndices[l-1]
 		p.recycledIndices = p.recycledIndices[:l-1]
+		p.denseEntities[denseIdx] = entity
 	}
 	p.sparseIndices[entity] = denseIdx
 	p.world.onEntityChange(entity, p.id, true)
@@ -125,7 +134,11 @@ func (p *Pool[T]) Del(entity int) {
 	p.world.onEntityChange(entity, p.id, false)
 	denseIdx := p.sparseIndices[entity]
 	p.sparseIndices[entity] = 0
+	p.denseEntities[denseIdx] = -1
 	p.recycledIndices = append(p.recycledIndices, denseIdx)
+	if p.refs {
+		p.unlinkEntityRef(entity, denseIdx)
+	}
 
 	if r, ok := any(&p.items[denseIdx]).(IComponentReset); ok {
 		r.Reset()
@@ -149,6 +162,16 @@ func (p *Pool[T]) GetSparseIndices() []int {
 	return p.sparseIndices
 }
 
+// GetEntities appends all entities with component to list in dense storage order.
+func (p *Pool[T]) GetEntities(list []int) []int {
+	for _, entity := range p.denseEntities[1:] {
+		if entity >= 0 {
+			list = append(list, entity)
+		}
+	}
+	return list
+}
+
 func (p *Pool[T]) GetRaw(entity int) any {
 	return p.Get(entity)
 }
@@ -172,10 +195,24 @@ func (p *Pool[T]) Copy(srcEntity, dstEntity int) {
 			p.Add(dstEntity)
 		}
 		dstData := p.Get(dstEntity)
+		if p.refs {
+			p.unlinkEntityRef(dstEntity, p.sparseIndices[dstEntity])
+		}
 		if c, ok := any(dstData).(IComponentCopy[T]); ok {
 			c.Copy(srcData)
 		} else {
 			*dstData = *srcData
 		}
+		if p.refs {
+			if target, gen := any(dstData).(iEntityRef).getRef(); gen > 0 {
+				p.world.linkEntityRef(target, dstEntity, p.id)
+			}
+		}
+	}
+}
+
+func (p *Pool[T]) unlinkEntityRef(referrer, denseIdx int) {
+	if target, gen := any(&p.items[denseIdx]).(iEntityRef).getRef(); gen > 0 {
+		p.world.unlinkEntityRef(target, referrer, p.id)
 	}
 }
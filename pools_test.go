@@ -210,3 +210,26 @@ func TestInvalidCopyNoDstEntity(t *testing.T) {
 	p.Copy(srcE, 1)
 	t.Errorf("code should panic")
 }
+
+func TestPoolGetEntities(t *testing.T) {
+	w := ecs.NewWorld()
+	p := ecs.GetPool[C1](w)
+	var entities []int
+	for i := 0; i < 5; i++ {
+		e := w.NewEntity()
+		p.Add(e)
+		entities = append(entities, e)
+	}
+	p.Del(entities[1])
+	p.Del(entities[3])
+	list := p.GetEntities(nil)
+	if len(list) != 3 || list[0] != entities[0] || list[1] != entities[2] || list[2] != entities[4] {
+		t.Errorf("invalid pool entities: %v", list)
+	}
+	e := w.NewEntity()
+	p.Add(e)
+	if list = p.GetEntities(list[:0]); len(list) != 4 {
+		t.Errorf("invalid pool entities after reuse: %v", list)
+	}
+	w.Destroy()
+}
@@ -0,0 +1,165 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+package ecs // import "leopotam.com/go/ecs"
+
+// RefPolicy describes behaviour of referrer entity on target entity destroying.
+type RefPolicy int
+
+const (
+	// RefNullify resets reference, referrer keeps EntityRef component.
+	RefNullify RefPolicy = 0
+	// RefNotify resets reference and calls IEntityRefListener.OnEntityRefReset().
+	RefNotify RefPolicy = 1
+	// RefDestroyReferrer destroys referrer entity.
+	RefDestroyReferrer RefPolicy = 2
+)
+
+type IEntityRefListener interface {
+	OnEntityRefReset(referrer, target int, refPool IPool)
+}
+
+// EntityRef is weak reference to entity, registered in world index.
+// K is marker type for multiple references on same entity.
+// Reference should be changed only with SetEntityRef() call.
+type EntityRef[K any] struct {
+	target int
+	gen    int32
+	policy RefPolicy
+}
+
+type iEntityRef interface {
+	getRef() (int, int32)
+	getRefPolicy() RefPolicy
+	resetRef()
+}
+
+type entityRefLink struct {
+	referrer int
+	pool     int16
+}
+
+// GetTarget returns target entity, false - reference not set or target was destroyed.
+func (r *EntityRef[K]) GetTarget() (int, bool) {
+	return r.target, r.gen > 0
+}
+
+func (r *EntityRef[K]) GetPolicy() RefPolicy {
+	return r.policy
+}
+
+func (r *EntityRef[K]) getRef() (int, int32) {
+	return r.target, r.gen
+}
+
+func (r *EntityRef[K]) getRefPolicy() RefPolicy {
+	return r.policy
+}
+
+func (r *EntityRef[K]) resetRef() {
+	r.target = 0
+	r.gen = 0
+}
+
+// SetEntityRef links referrer with target, EntityRef[K] component will be added to referrer if required.
+func SetEntityRef[K any](w *World, referrer, target int, policy RefPolicy) {
+	if DEBUG && !w.checkEntityAlive(target) {
+		panic("cant reference destroyed entity")
+	}
+	pool := GetPool[EntityRef[K]](w)
+	var ref *EntityRef[K]
+	if pool.Has(referrer) {
+		ref = pool.Get(referrer)
+		if ref.gen > 0 {
+			w.unlinkEntityRef(ref.target, referrer, pool.id)
+		}
+	} else {
+		ref = pool.Add(referrer)
+	}
+	ref.target = target
+	ref.gen = w.GetEntityGen(target)
+	ref.policy = policy
+	w.linkEntityRef(target, referrer, pool.id)
+}
+
+// GetEntityReferrers appends to list all entities with references to target
+// (entity will be added multiple times for different EntityRef types).
+func (w *World) GetEntityReferrers(target int, list []int) []int {
+	for _, link := range w.refs[target] {
+		list = append(list, link.referrer)
+	}
+	return list
+}
+
+func (w *World) AddEntityRefListener(l IEntityRefListener) {
+	w.refListeners = append(w.refListeners, l)
+}
+
+func (w *World) RemoveEntityRefListener(l IEntityRefListener) {
+	for idx, v := range w.refListeners {
+		if v == l {
+			copy(w.refListeners[idx:], w.refListeners[idx+1:])
+			w.refListeners[len(w.refListeners)-1] = nil
+			w.refListeners = w.refListeners[:len(w.refListeners)-1]
+			return
+		}
+	}
+}
+
+func (w *World) linkEntityRef(target, referrer int, pool int16) {
+	if w.refs == nil {
+		w.refs = make(map[int][]entityRefLink)
+	}
+	w.refs[target] = append(w.refs[target], entityRefLink{referrer: referrer, pool: pool})
+}
+
+func (w *World) unlinkEntityRef(target, referrer int, pool int16) {
+	links := w.refs[target]
+	for i, link := range links {
+		if link.referrer == referrer && link.pool == pool {
+			last := len(links) - 1
+			links[i] = links[last]
+			links = links[:last]
+			break
+		}
+	}
+	if len(links) == 0 {
+		delete(w.refs, target)
+	} else {
+		w.refs[target] = links
+	}
+}
+
+// onEntityRefTargetDestroyed applies policies of all references to destroyed target.
+func (w *World) onEntityRefTargetDestroyed(target int) {
+	links, ok := w.refs[target]
+	if !ok {
+		return
+	}
+	delete(w.refs, target)
+	for _, link := range links {
+		pool := w.pools[link.pool]
+		// referrer can be destroyed by previous links processing.
+		if !w.checkEntityAlive(link.referrer) || !pool.Has(link.referrer) {
+			continue
+		}
+		ref := pool.GetRaw(link.referrer).(iEntityRef)
+		if refTarget, gen := ref.getRef(); refTarget != target || gen <= 0 {
+			continue
+		}
+		switch ref.getRefPolicy() {
+		case RefDestroyReferrer:
+			ref.resetRef()
+			w.DelEntity(link.referrer)
+		case RefNotify:
+			ref.resetRef()
+			for _, l := range w.refListeners {
+				l.OnEntityRefReset(link.referrer, target, pool)
+			}
+		default:
+			ref.resetRef()
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// ----------------------------------------------------------------------------
+// The Proprietary or MIT-Red License
+// Copyright (c) 2012-2022 Leopotam <leopotam@yandex.ru>
+// ----------------------------------------------------------------------------
+
+package ecs_test
+
+import (
+	"testing"
+
+	"leopotam.com/go/ecs"
+)
+
+type RefOwner struct{}
+type RefTarget struct{}
+
+type refListener struct {
+	Referrers []int
+	Targets   []int
+}
+
+func (l *refListener) OnEntityRefReset(referrer, target int, refPool ecs.IPool) {
+	l.Referrers = append(l.Referrers, referrer)
+	l.Targets = append(l.Targets, target)
+}
+
+func TestEntityRefNullify(t *testing.T) {
+	w := ecs.NewWorld()
+	target := w.NewEntity()
+	ecs.GetPool[C1](w).Add(target)
+	referrer := w.NewEntity()
+	ecs.SetEntityRef[RefOwner](w, referrer, target, ecs.RefNullify)
+	refs := ecs.GetPool[ecs.EntityRef[RefOwner]](w)
+	if e, ok := refs.Get(referrer).GetTarget(); !ok || e != target {
+		t.Errorf("invalid reference target")
+	}
+	if list := w.GetEntityReferrers(target, nil); len(list) != 1 || list[0] != referrer {
+		t.Errorf("invalid referrers: %v", list)
+	}
+	w.DelEntity(target)
+	if _, ok := refs.Get(referrer).GetTarget(); ok {
+		t.Errorf("reference should be reset")
+	}
+	if list := w.GetEntityReferrers(target, nil); len(list) != 0 {
+		t.Errorf("referrers should be removed: %v", list)
+	}
+	w.Destroy()
+}
+
+func TestEntityRefNotifyAndDestroy(t *testing.T) {
+	w := ecs.NewWorld()
+	l := &refListener{}
+	w.AddEntityRefListener(l)
+	target := w.NewEntity()
+	ecs.GetPool[C1](w).Add(target)
+	notified := w.NewEntity()
+	destroyed := w.NewEntity()
+	ecs.SetEntityRef[RefOwner](w, notified, target, ecs.RefNotify)
+	ecs.SetEntityRef[RefTarget](w, destroyed, target, ecs.RefDestroyReferrer)
+	ecs.SetEntityRef[RefOwner](w, destroyed, notified, ecs.RefNullify)
+	if list := w.GetEntityReferrers(target, nil); len(list) != 2 {
+		t.Errorf("invalid referrers: %v", list)
+	}
+	ecs.GetPool[C1](w).Del(target)
+	if len(l.Referrers) != 1 || l.Referrers[0] != notified || l.Targets[0] != target {
+		t.Errorf("invalid notifications: %v, %v", l.Referrers, l.Targets)
+	}
+	if w.GetEntityGen(destroyed) > 0 {
+		t.Errorf("referrer should be destroyed")
+	}
+	// destroyed referrer should be unlinked from own targets.
+	if list := w.GetEntityReferrers(notified, nil); len(list) != 0 {
+		t.Errorf("referrers should be removed: %v", list)
+	}
+	w.RemoveEntityRefListener(l)
+	w.Destroy()
+}
+
+func TestEntityRefRelinkAndCopy(t *testing.T) {
+	w := ecs.NewWorld()
+	target1 := w.NewEntity()
+	target2 := w.NewEntity()
+	ecs.GetPool[C1](w).Add(target1)
+	ecs.GetPool[C1](w).Add(target2)
+	referrer := w.NewEntity()
+	ecs.SetEntityRef[RefOwner](w, referrer, target1, ecs.RefNullify)
+	ecs.SetEntityRef[RefOwner](w, referrer, target2, ecs.RefNullify)
+	if list := w.GetEntityReferrers(target1, nil); len(list) != 0 {
+		t.Errorf("old target should be unlinked: %v", list)
+	}
+	copied := w.NewEntity()
+	w.CopyEntity(referrer, copied)
+	if list := w.GetEntityReferrers(target2, nil); len(list) != 2 {
+		t.Errorf("copied reference should be linked: %v", list)
+	}
+	ecs.GetPool[ecs.EntityRef[RefOwner]](w).Del(referrer)
+	if list := w.GetEntityReferrers(target2, nil); len(list) != 1 || list[0] != copied {
+		t.Errorf("removed reference should be unlinked: %v", list)
+	}
+	w.Destroy()
+}
@@ -8,20 +8,34 @@ package ecs // import "leopotam.com/go/ecs"
 import (
 	"fmt"
 	"reflect"
+	"runtime/debug"
+	"strings"
 )
 
 type IPreInitSystem interface {
 	PreInit(systems ISystems)
 }
 
+type IPreInitSystemErr interface {
+	PreInit(systems ISystems) error
+}
+
 type IInitSystem interface {
 	Init(systems ISystems)
 }
 
+type IInitSystemErr interface {
+	Init(systems ISystems) error
+}
+
 type IRunSystem interface {
 	Run(systems ISystems)
 }
 
+type IRunSystemErr interface {
+	Run(systems ISystems) error
+}
+
 type IDestroySystem interface {
 	Destroy(systems ISystems)
 }
@@ -30,56 +44,253 @@ type IPostDestroySystem interface {
 	PostDestroy(systems ISystems)
 }
 
+type ISystemsEventListener interface {
+	OnSystemAdded(systems ISystems, system any)
+	OnSystemRemoved(systems ISystems, system any)
+	OnSystemsDestroyed(systems ISystems)
+}
+
 type ISystems interface {
 	Add(system any) ISystems
+	Remove(system any) error
+	Replace(oldSystem, newSystem any) error
+	AddEventListener(l ISystemsEventListener)
+	RemoveEventListener(l ISystemsEventListener)
+	GetEventListeners(list []ISystemsEventListener) []ISystemsEventListener
 	GetAllSystems() []any
+	GetFaultedSystems(list []any) []any
 	AddWorld(world *World, name string) ISystems
 	GetWorld(name string) *World
 	GetNamedWorlds() map[string]*World
-	Init()
-	Run()
+	Init() error
+	Run() error
 	Destroy()
 }
 
+type SystemsErrorPolicy int
+
+const (
+	// Stop current Init() / Run() call on first failed system.
+	SystemsErrorPolicyStop SystemsErrorPolicy = 0
+	// Skip failed system and continue with next one.
+	SystemsErrorPolicySkip SystemsErrorPolicy = 1
+	// Skip failed system and disable it after SystemsConfig.DisableAfterFailures failures.
+	SystemsErrorPolicyDisable SystemsErrorPolicy = 2
+)
+
+type SystemsConfig struct {
+	ErrorPolicy          SystemsErrorPolicy
+	DisableAfterFailures int
+	// Recover panics inside IRunSystem / IRunSystemErr systems and mark them as faulted,
+	// recovered panic will be returned from Run() as SystemError with *SystemPanic inside.
+	RecoverPanics bool
+	PanicHandler  func(info SystemPanic)
+	// Disable automatic playback of world command buffers at the end of Run(),
+	// PlaybackHere() sync points still will be processed.
+	ManualCommandsPlayback bool
+}
+
+const defaultSystemsDisableAfterFailures int = 1
+
+type SystemError struct {
+	System any
+	Method string
+	Err    error
+}
+
+func (e *SystemError) Error() string {
+	return fmt.Sprintf("%s.%s(): %s", reflect.TypeOf(e.System).String(), e.Method, e.Err.Error())
+}
+
+func (e *SystemError) Unwrap() error {
+	return e.Err
+}
+
+type SystemsError struct {
+	Errors []*SystemError
+}
+
+func (e *SystemsError) Error() string {
+	var sb strings.Builder
+	for i, err := range e.Errors {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(err.Error())
+	}
+	return sb.String()
+}
+
+func (e *SystemsError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+type SystemPanic struct {
+	System any
+	Value  any
+	Stack  []byte
+}
+
+func (p *SystemPanic) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+type runItem struct {
+	system   any
+	run      IRunSystem
+	runErr   IRunSystemErr
+	failures int
+	disabled bool
+	faulted  bool
+}
+
 type systems struct {
-	defWorld    *World
-	namedWorlds map[string]*World
-	all         []any
-	run         []IRunSystem
+	config         SystemsConfig
+	defWorld       *World
+	namedWorlds    map[string]*World
+	all            []any
+	run            []runItem
+	eventListeners []ISystemsEventListener
+	filterLocks    []filterLock
+	initialized    bool
+	running        bool
 }
 
 func NewSystems(world *World) ISystems {
+	return NewSystemsWithConfig(world, SystemsConfig{})
+}
+
+func NewSystemsWithConfig(world *World, config SystemsConfig) ISystems {
+	if config.DisableAfterFailures <= 0 {
+		config.DisableAfterFailures = defaultSystemsDisableAfterFailures
+	}
 	return &systems{
+		config:      config,
 		defWorld:    world,
 		namedWorlds: make(map[string]*World, 4),
 		all:         make([]any, 0, 128),
-		run:         make([]IRunSystem, 0, 128),
+		run:         make([]runItem, 0, 128),
 	}
 }
 
 func (s *systems) Add(system any) ISystems {
 	if DEBUG {
-		switch system.(type) {
-		case IPreInitSystem:
-		case IInitSystem:
-		case IRunSystem:
-		case IDestroySystem:
-		case IPostDestroySystem:
-		default:
-			panic(fmt.Sprintf("invalid system type \"%s\"", reflect.TypeOf(system).String()))
-		}
+		debugCheckSystemType(system)
 	}
 	s.all = append(s.all, system)
-	if runSystem, ok := system.(IRunSystem); ok {
-		s.run = append(s.run, runSystem)
+	if item, ok := newRunItem(system); ok {
+		s.run = append(s.run, item)
+	}
+	for _, l := range s.eventListeners {
+		l.OnSystemAdded(s, system)
 	}
 	return s
 }
 
+func (s *systems) Remove(system any) error {
+	if DEBUG && s.running {
+		panic("cant remove system inside ISystems.Run()")
+	}
+	idx := s.indexOf(system)
+	if idx < 0 {
+		return fmt.Errorf("system \"%s\" not found", reflect.TypeOf(system).String())
+	}
+	if s.initialized {
+		s.destroySystem(system)
+		s.postDestroySystem(system)
+	}
+	copy(s.all[idx:], s.all[idx+1:])
+	s.all[len(s.all)-1] = nil
+	s.all = s.all[:len(s.all)-1]
+	s.rebuildRunList()
+	for _, l := range s.eventListeners {
+		l.OnSystemRemoved(s, system)
+	}
+	return nil
+}
+
+func (s *systems) Replace(oldSystem, newSystem any) error {
+	if DEBUG {
+		if s.running {
+			panic("cant replace system inside ISystems.Run()")
+		}
+		debugCheckSystemType(newSystem)
+	}
+	idx := s.indexOf(oldSystem)
+	if idx < 0 {
+		return fmt.Errorf("system \"%s\" not found", reflect.TypeOf(oldSystem).String())
+	}
+	if s.initialized {
+		s.destroySystem(oldSystem)
+		s.postDestroySystem(oldSystem)
+	}
+	s.all[idx] = newSystem
+	s.rebuildRunList()
+	for _, l := range s.eventListeners {
+		l.OnSystemRemoved(s, oldSystem)
+	}
+	for _, l := range s.eventListeners {
+		l.OnSystemAdded(s, newSystem)
+	}
+	if !s.initialized {
+		return nil
+	}
+	var errs *SystemsError
+	if err := s.preInitSystem(newSystem); err != nil {
+		errs = s.onSystemError(errs, newSystem, "PreInit", err)
+		if s.config.ErrorPolicy == SystemsErrorPolicyStop {
+			return errs
+		}
+	}
+	if err := s.initSystem(newSystem); err != nil {
+		errs = s.onSystemError(errs, newSystem, "Init", err)
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+func (s *systems) AddEventListener(l ISystemsEventListener) {
+	s.eventListeners = append(s.eventListeners, l)
+}
+
+func (s *systems) RemoveEventListener(l ISystemsEventListener) {
+	i := -1
+	for idx, v := range s.eventListeners {
+		if v == l {
+			i = idx
+			break
+		}
+	}
+	if i > -1 {
+		copy(s.eventListeners[i:], s.eventListeners[i+1:])
+		s.eventListeners[len(s.eventListeners)-1] = nil
+		s.eventListeners = s.eventListeners[:len(s.eventListeners)-1]
+	}
+}
+
+func (s *systems) GetEventListeners(list []ISystemsEventListener) []ISystemsEventListener {
+	return append(list, s.eventListeners...)
+}
+
 func (s *systems) GetAllSystems() []any {
 	return s.all
 }
 
+func (s *systems) GetFaultedSystems(list []any) []any {
+	for i := range s.run {
+		if s.run[i].faulted {
+			list = append(list, s.run[i].system)
+		}
+	}
+	return list
+}
+
 func (s *systems) AddWorld(world *World, name string) ISystems {
 	if DEBUG {
 		if _, ok := s.namedWorlds[name]; ok {
@@ -104,71 +315,339 @@ func (s *systems) GetNamedWorlds() map[string]*World {
 	return s.namedWorlds
 }
 
-func (s *systems) Init() {
+func (s *systems) Init() error {
+	s.initialized = true
+	var errs *SystemsError
 	for _, system := range s.all {
-		if preInitSystem, ok := system.(IPreInitSystem); ok {
-			preInitSystem.PreInit(s)
-			if DEBUG {
-				worldName := debugCheckSystemsForLeakedEntities(s)
-				if len(worldName) > 0 {
-					panic(fmt.Sprintf("empty entity detected in world \"%s\" after {%s}.PreInit()", worldName, reflect.TypeOf(system).String()))
-				}
+		if err := s.preInitSystem(system); err != nil {
+			errs = s.onSystemError(errs, system, "PreInit", err)
+			if s.config.ErrorPolicy == SystemsErrorPolicyStop {
+				return errs
 			}
 		}
 	}
 	for _, system := range s.all {
-		if initSystem, ok := system.(IInitSystem); ok {
-			initSystem.Init(s)
-			if DEBUG {
-				worldName := debugCheckSystemsForLeakedEntities(s)
-				if len(worldName) > 0 {
-					panic(fmt.Sprintf("empty entity detected in world \"%s\" after {%s}.Init()", worldName, reflect.TypeOf(system).String()))
-				}
+		if err := s.initSystem(system); err != nil {
+			errs = s.onSystemError(errs, system, "Init", err)
+			if s.config.ErrorPolicy == SystemsErrorPolicyStop {
+				return errs
 			}
 		}
 	}
+	if errs != nil {
+		return errs
+	}
+	return nil
 }
 
-func (s *systems) Run() {
-	for _, system := range s.run {
-		system.Run(s)
+func (s *systems) Run() error {
+	s.running = true
+	var errs *SystemsError
+	for i := range s.run {
+		item := &s.run[i]
+		if item.disabled || item.faulted {
+			continue
+		}
+		var err error
+		if s.config.RecoverPanics {
+			err = s.runSystemWithRecover(item)
+		} else {
+			err = s.runSystem(item)
+		}
+		if DEBUG {
+			if item.faulted {
+				// recovered panic can interrupt system between NewEntity() and Add() calls.
+				debugResetSystemsLeakedEntities(s)
+			} else if worldName := debugCheckSystemsForLeakedEntities(s); len(worldName) > 0 {
+				panic(fmt.Sprintf("empty entity detected in world \"%s\" after %s.Run()", worldName, reflect.TypeOf(item.system).String()))
+			}
+		}
+		if err != nil {
+			errs = s.onSystemError(errs, item.system, "Run", err)
+			// faulted system already isolated, rest of systems can be processed.
+			if s.config.ErrorPolicy == SystemsErrorPolicyStop && !item.faulted {
+				break
+			}
+		}
+	}
+	s.endFrame()
+	s.running = false
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+func (s *systems) endFrame() {
+	s.endWorldFrame(s.defWorld)
+	for name, world := range s.namedWorlds {
+		if world == s.defWorld {
+			continue
+		}
+		// same world can be registered with different names.
+		processed := false
+		for name2, world2 := range s.namedWorlds {
+			if world2 == world && name2 < name {
+				processed = true
+				break
+			}
+		}
+		if !processed {
+			s.endWorldFrame(world)
+		}
+	}
+}
+
+func (s *systems) endWorldFrame(world *World) {
+	if world.commands != nil && !s.config.ManualCommandsPlayback {
+		world.commands.Playback()
+	}
+	world.UpdateEvents()
+}
+
+func (s *systems) preInitSystem(system any) error {
+	var err error
+	switch preInitSystem := system.(type) {
+	case IPreInitSystem:
+		preInitSystem.PreInit(s)
+	case IPreInitSystemErr:
+		err = preInitSystem.PreInit(s)
+	default:
+		return nil
+	}
+	if DEBUG {
+		worldName := debugCheckSystemsForLeakedEntities(s)
+		if len(worldName) > 0 {
+			panic(fmt.Sprintf("empty entity detected in world \"%s\" after {%s}.PreInit()", worldName, reflect.TypeOf(system).String()))
+		}
+	}
+	return err
+}
+
+func (s *systems) initSystem(system any) error {
+	var err error
+	switch initSystem := system.(type) {
+	case IInitSystem:
+		initSystem.Init(s)
+	case IInitSystemErr:
+		err = initSystem.Init(s)
+	default:
+		return nil
+	}
+	if DEBUG {
+		worldName := debugCheckSystemsForLeakedEntities(s)
+		if len(worldName) > 0 {
+			panic(fmt.Sprintf("empty entity detected in world \"%s\" after {%s}.Init()", worldName, reflect.TypeOf(system).String()))
+		}
+	}
+	return err
+}
+
+func (s *systems) destroySystem(system any) {
+	if destroySystem, ok := system.(IDestroySystem); ok {
+		destroySystem.Destroy(s)
 		if DEBUG {
 			worldName := debugCheckSystemsForLeakedEntities(s)
 			if len(worldName) > 0 {
-				panic(fmt.Sprintf("empty entity detected in world \"%s\" after %s.Run()", worldName, reflect.TypeOf(system).String()))
+				panic(fmt.Sprintf("empty entity detected in world \"%s\" after %s.Destroy()", worldName, reflect.TypeOf(destroySystem).String()))
 			}
 		}
 	}
 }
 
-func (s *systems) Destroy() {
-	for i := len(s.all) - 1; i >= 0; i-- {
-		if destroySystem, ok := s.all[i].(IDestroySystem); ok {
-			destroySystem.Destroy(s)
-			if DEBUG {
-				worldName := debugCheckSystemsForLeakedEntities(s)
-				if len(worldName) > 0 {
-					panic(fmt.Sprintf("empty entity detected in world \"%s\" after %s.Destroy()", worldName, reflect.TypeOf(destroySystem).String()))
-				}
+func (s *systems) postDestroySystem(system any) {
+	if postDestroySystem, ok := system.(IPostDestroySystem); ok {
+		postDestroySystem.PostDestroy(s)
+		if DEBUG {
+			worldName := debugCheckSystemsForLeakedEntities(s)
+			if len(worldName) > 0 {
+				panic(fmt.Sprintf("empty entity detected in world \"%s\" after %s.PostDestroy()", worldName, reflect.TypeOf(postDestroySystem).String()))
 			}
 		}
 	}
-	for i := len(s.all) - 1; i >= 0; i-- {
-		if postDestroySystem, ok := s.all[i].(IPostDestroySystem); ok {
-			postDestroySystem.PostDestroy(s)
-			if DEBUG {
-				worldName := debugCheckSystemsForLeakedEntities(s)
-				if len(worldName) > 0 {
-					panic(fmt.Sprintf("empty entity detected in world \"%s\" after %s.PostDestroy()", worldName, reflect.TypeOf(postDestroySystem).String()))
+}
+
+func (s *systems) runSystem(item *runItem) error {
+	if item.run != nil {
+		item.run.Run(s)
+		return nil
+	}
+	return item.runErr.Run(s)
+}
+
+func (s *systems) runSystemWithRecover(item *runItem) (err error) {
+	locks := appendFilterLocks(s.defWorld, s.filterLocks[:0])
+	for _, world := range s.namedWorlds {
+		locks = appendFilterLocks(world, locks)
+	}
+	s.filterLocks = locks
+	defer func() {
+		if r := recover(); r != nil {
+			item.faulted = true
+			// iterators of panicked system were not destroyed.
+			restoreFilterLocks(s.defWorld, s.filterLocks)
+			for _, world := range s.namedWorlds {
+				restoreFilterLocks(world, s.filterLocks)
+			}
+			info := SystemPanic{
+				System: item.system,
+				Value:  r,
+				Stack:  debug.Stack(),
+			}
+			if s.config.PanicHandler != nil {
+				s.config.PanicHandler(info)
+			}
+			err = &info
+		}
+	}()
+	return s.runSystem(item)
+}
+
+func (s *systems) onSystemError(errs *SystemsError, system any, method string, err error) *SystemsError {
+	if errs == nil {
+		errs = &SystemsError{}
+	}
+	errs.Errors = append(errs.Errors, &SystemError{System: system, Method: method, Err: err})
+	if s.config.ErrorPolicy == SystemsErrorPolicyDisable {
+		for i := range s.run {
+			if item := &s.run[i]; item.system == system {
+				item.failures++
+				if item.failures >= s.config.DisableAfterFailures {
+					item.disabled = true
 				}
+				break
 			}
 		}
 	}
+	return errs
+}
+
+func (s *systems) Destroy() {
+	for i := len(s.all) - 1; i >= 0; i-- {
+		s.destroySystem(s.all[i])
+	}
+	for i := len(s.all) - 1; i >= 0; i-- {
+		s.postDestroySystem(s.all[i])
+	}
+	for _, l := range s.eventListeners {
+		l.OnSystemsDestroyed(s)
+	}
 	for k := range s.namedWorlds {
 		delete(s.namedWorlds, k)
 	}
+	for i := range s.eventListeners {
+		s.eventListeners[i] = nil
+	}
+	s.eventListeners = s.eventListeners[:0]
 	s.all = s.all[:0]
 	s.run = s.run[:0]
+	s.initialized = false
+}
+
+func (s *systems) indexOf(system any) int {
+	for i, v := range s.all {
+		if v == system {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *systems) rebuildRunList() {
+	run := make([]runItem, 0, cap(s.run))
+	for _, system := range s.all {
+		item, ok := newRunItem(system)
+		if !ok {
+			continue
+		}
+		// keep failures / faulted state of untouched systems.
+		for i := range s.run {
+			if s.run[i].system == system {
+				item = s.run[i]
+				break
+			}
+		}
+		run = append(run, item)
+	}
+	s.run = run
+}
+
+func newRunItem(system any) (runItem, bool) {
+	switch runSystem := system.(type) {
+	case IRunSystem:
+		return runItem{system: system, run: runSystem}, true
+	case IRunSystemErr:
+		return runItem{system: system, runErr: runSystem}, true
+	}
+	return runItem{}, false
+}
+
+func debugCheckSystemType(system any) {
+	switch system.(type) {
+	case IPreInitSystem:
+	case IPreInitSystemErr:
+	case IInitSystem:
+	case IInitSystemErr:
+	case IRunSystem:
+	case IRunSystemErr:
+	case IDestroySystem:
+	case IPostDestroySystem:
+	default:
+		panic(fmt.Sprintf("invalid system type \"%s\"", reflect.TypeOf(system).String()))
+	}
+}
+
+type delHereSystem[T any] struct {
+	worldName string
+	pool      *Pool[T]
+	filter    *Filter
+}
+
+// DelHere adds system that removes all T components from world with name worldName
+// at current position of systems pipeline.
+func DelHere[T any](systems ISystems, worldName string) ISystems {
+	return systems.Add(&delHereSystem[T]{worldName: worldName})
+}
+
+func (s *delHereSystem[T]) Run(systems ISystems) {
+	if s.pool == nil {
+		w := systems.GetWorld(s.worldName)
+		if DEBUG && w == nil {
+			panic(fmt.Sprintf("cant get Pool[%s] from undefined world with name \"%s\"", reflect.TypeOf((*T)(nil)).Elem().String(), s.worldName))
+		}
+		s.pool = GetPool[T](w)
+		s.filter = GetFilter[Inc1[T]](w)
+	}
+	for entities := s.filter.GetRawEntities(); len(entities) > 0; entities = s.filter.GetRawEntities() {
+		s.pool.Del(entities[len(entities)-1])
+	}
+}
+
+type playbackHereSystem struct {
+	worldName string
+}
+
+// PlaybackHere adds system that applies commands of world with name worldName
+// at current position of systems pipeline.
+func PlaybackHere(systems ISystems, worldName string) ISystems {
+	return systems.Add(&playbackHereSystem{worldName: worldName})
+}
+
+func (s *playbackHereSystem) Run(systems ISystems) {
+	w := systems.GetWorld(s.worldName)
+	if DEBUG && w == nil {
+		panic(fmt.Sprintf("cant playback commands of undefined world with name \"%s\"", s.worldName))
+	}
+	if w.commands != nil {
+		w.commands.Playback()
+	}
+}
+
+func debugResetSystemsLeakedEntities(s *systems) {
+	s.defWorld.debugLeakedEntities = s.defWorld.debugLeakedEntities[:0]
+	for _, world := range s.namedWorlds {
+		world.debugLeakedEntities = world.debugLeakedEntities[:0]
+	}
 }
 
 func debugCheckSystemsForLeakedEntities(s *systems) string {
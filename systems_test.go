@@ -6,6 +6,8 @@
 package ecs_test
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 
 	"leopotam.com/go/ecs"
@@ -43,6 +45,95 @@ func (s *PostDestroySystem1) PostDestroy(systems ecs.ISystems) {
 	*s.Counter++
 }
 
+var errSystemFailed = errors.New("system failed")
+
+type InitErrSystem1 struct {
+	Counter *int
+	Fail    bool
+}
+type RunErrSystem1 struct {
+	Counter *int
+	Fail    bool
+}
+
+func (s *InitErrSystem1) Init(systems ecs.ISystems) error {
+	*s.Counter++
+	if s.Fail {
+		return errSystemFailed
+	}
+	return nil
+}
+func (s *RunErrSystem1) Run(systems ecs.ISystems) error {
+	*s.Counter++
+	if s.Fail {
+		return errSystemFailed
+	}
+	return nil
+}
+
+type PanicRunSystem1 struct {
+	Counter *int
+}
+
+func (s *PanicRunSystem1) Run(systems ecs.ISystems) {
+	*s.Counter++
+	panic("run failed")
+}
+
+type LeakPanicRunSystem1 struct{}
+
+func (s *LeakPanicRunSystem1) Run(systems ecs.ISystems) {
+	systems.GetWorld("").NewEntity()
+	panic("run failed")
+}
+
+type FilterPanicRunSystem1 struct{}
+
+func (s *FilterPanicRunSystem1) Run(systems ecs.ISystems) {
+	w := systems.GetWorld("")
+	for it := ecs.GetFilter[ecs.Inc1[C1]](w).Iter(); it.Next(); {
+		panic("run failed")
+	}
+}
+
+type LifecycleSystem1 struct {
+	Calls []string
+}
+
+func (s *LifecycleSystem1) PreInit(systems ecs.ISystems) { s.Calls = append(s.Calls, "PreInit") }
+func (s *LifecycleSystem1) Init(systems ecs.ISystems)    { s.Calls = append(s.Calls, "Init") }
+func (s *LifecycleSystem1) Run(systems ecs.ISystems)     { s.Calls = append(s.Calls, "Run") }
+func (s *LifecycleSystem1) Destroy(systems ecs.ISystems) { s.Calls = append(s.Calls, "Destroy") }
+func (s *LifecycleSystem1) PostDestroy(systems ecs.ISystems) {
+	s.Calls = append(s.Calls, "PostDestroy")
+}
+
+type systemsEventListener struct {
+	added     []any
+	removed   []any
+	destroyed int
+}
+
+func (l *systemsEventListener) OnSystemAdded(systems ecs.ISystems, system any) {
+	l.added = append(l.added, system)
+}
+func (l *systemsEventListener) OnSystemRemoved(systems ecs.ISystems, system any) {
+	l.removed = append(l.removed, system)
+}
+func (l *systemsEventListener) OnSystemsDestroyed(systems ecs.ISystems) {
+	l.destroyed++
+}
+
+type OneFrameSystem1 struct {
+	Counts []int
+}
+
+func (s *OneFrameSystem1) Run(systems ecs.ISystems) {
+	w := systems.GetWorld("")
+	s.Counts = append(s.Counts, ecs.GetFilter[ecs.Inc1[C1]](w).GetEntitiesCount())
+	ecs.GetPool[C1](w).Add(w.NewEntity())
+}
+
 type InvalidSystem1 struct{}
 type PreInitInvalidSystem1 struct{}
 type InitInvalidSystem1 struct{}
@@ -278,3 +369,349 @@ func TestSystemsAddWorldTwice(t *testing.T) {
 	systems.AddWorld(w, "events")
 	t.Errorf("code should panic")
 }
+
+func TestSystemsErrNoErrors(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	counter := 0
+	s.
+		Add(&InitErrSystem1{Counter: &counter}).
+		Add(&RunErrSystem1{Counter: &counter})
+	if err := s.Init(); err != nil {
+		t.Errorf("unexpected init error: %v", err)
+	}
+	if err := s.Run(); err != nil {
+		t.Errorf("unexpected run error: %v", err)
+	}
+	if counter != 2 {
+		t.Errorf("invalid system calls: %v", counter)
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestSystemsErrPolicyStop(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	counter := 0
+	s.
+		Add(&InitErrSystem1{Counter: &counter, Fail: true}).
+		Add(&InitSystem1{Counter: &counter}).
+		Add(&RunErrSystem1{Counter: &counter, Fail: true}).
+		Add(&RunSystem1{Counter: &counter})
+	err := s.Init()
+	var systemsErr *ecs.SystemsError
+	if !errors.As(err, &systemsErr) || len(systemsErr.Errors) != 1 {
+		t.Fatalf("invalid init error: %v", err)
+	}
+	if systemsErr.Errors[0].Method != "Init" || !errors.Is(systemsErr.Errors[0], errSystemFailed) {
+		t.Errorf("invalid system error: %v", systemsErr.Errors[0])
+	}
+	if counter != 1 {
+		t.Errorf("invalid system calls after init: %v", counter)
+	}
+	counter = 0
+	if err := s.Run(); err == nil {
+		t.Errorf("run error expected")
+	}
+	if counter != 1 {
+		t.Errorf("invalid system calls after run: %v", counter)
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestSystemsErrPolicySkip(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystemsWithConfig(w, ecs.SystemsConfig{ErrorPolicy: ecs.SystemsErrorPolicySkip})
+	counter := 0
+	s.
+		Add(&RunErrSystem1{Counter: &counter, Fail: true}).
+		Add(&RunErrSystem1{Counter: &counter, Fail: true}).
+		Add(&RunSystem1{Counter: &counter}).
+		Init()
+	for i := 0; i < 2; i++ {
+		err := s.Run()
+		var systemsErr *ecs.SystemsError
+		if !errors.As(err, &systemsErr) || len(systemsErr.Errors) != 2 {
+			t.Errorf("invalid run error: %v", err)
+		}
+	}
+	if counter != 6 {
+		t.Errorf("invalid system calls: %v", counter)
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestSystemsErrPolicyDisable(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystemsWithConfig(w, ecs.SystemsConfig{
+		ErrorPolicy:          ecs.SystemsErrorPolicyDisable,
+		DisableAfterFailures: 2,
+	})
+	failCounter := 0
+	counter := 0
+	s.
+		Add(&RunErrSystem1{Counter: &failCounter, Fail: true}).
+		Add(&RunSystem1{Counter: &counter}).
+		Init()
+	for i := 0; i < 4; i++ {
+		err := s.Run()
+		if i < 2 && err == nil {
+			t.Errorf("run error expected at frame %v", i)
+		}
+		if i >= 2 && err != nil {
+			t.Errorf("unexpected run error at frame %v: %v", i, err)
+		}
+	}
+	if failCounter != 2 {
+		t.Errorf("invalid failed system calls: %v", failCounter)
+	}
+	if counter != 4 {
+		t.Errorf("invalid system calls: %v", counter)
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestSystemsRecoverPanics(t *testing.T) {
+	w := ecs.NewWorldWithConfig(ecs.WorldConfig{Name: "match1"})
+	var panics []ecs.SystemPanic
+	s := ecs.NewSystemsWithConfig(w, ecs.SystemsConfig{
+		RecoverPanics: true,
+		PanicHandler: func(info ecs.SystemPanic) {
+			panics = append(panics, info)
+		},
+	})
+	panicCounter := 0
+	counter := 0
+	panicSystem := &PanicRunSystem1{Counter: &panicCounter}
+	s.
+		Add(panicSystem).
+		Add(&RunSystem1{Counter: &counter}).
+		Init()
+	for i := 0; i < 3; i++ {
+		err := s.Run()
+		if i == 0 {
+			errs, ok := err.(*ecs.SystemsError)
+			if !ok || len(errs.Errors) != 1 || errs.Errors[0].System != panicSystem {
+				t.Fatalf("invalid run error: %v", err)
+			}
+			if info, ok := errs.Errors[0].Err.(*ecs.SystemPanic); !ok || info.Value != "run failed" {
+				t.Errorf("invalid panic error: %v", errs.Errors[0].Err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected run error: %v", err)
+		}
+	}
+	if panicCounter != 1 || counter != 3 {
+		t.Errorf("invalid system calls: %v, %v", panicCounter, counter)
+	}
+	if len(panics) != 1 {
+		t.Fatalf("invalid panics amount: %v", len(panics))
+	}
+	info := panics[0]
+	if info.System != panicSystem || info.Value != "run failed" || len(info.Stack) == 0 {
+		t.Errorf("invalid panic info: %v", info)
+	}
+	if reflect.TypeOf(info.System) != reflect.TypeOf(&PanicRunSystem1{}) {
+		t.Errorf("invalid panic system type")
+	}
+	faulted := s.GetFaultedSystems(nil)
+	if len(faulted) != 1 || faulted[0] != panicSystem {
+		t.Errorf("invalid faulted systems: %v", faulted)
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestSystemsRecoverPanicsWithLeakedEntity(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystemsWithConfig(w, ecs.SystemsConfig{RecoverPanics: true})
+	counter := 0
+	s.Add(&LeakPanicRunSystem1{}).Add(&RunSystem1{Counter: &counter}).Init()
+	if err := s.Run(); err == nil {
+		t.Errorf("panic error expected")
+	}
+	if counter != 1 {
+		t.Errorf("next system should be called: %v", counter)
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestSystemsRecoverPanicsWithLockedFilter(t *testing.T) {
+	w := ecs.NewWorld()
+	pool := ecs.GetPool[C1](w)
+	pool.Add(w.NewEntity())
+	s := ecs.NewSystemsWithConfig(w, ecs.SystemsConfig{RecoverPanics: true})
+	s.Add(&FilterPanicRunSystem1{}).Init()
+	if err := s.Run(); err == nil {
+		t.Errorf("panic error expected")
+	}
+	pool.Add(w.NewEntity())
+	if count := ecs.GetFilter[ecs.Inc1[C1]](w).GetEntitiesCount(); count != 2 {
+		t.Errorf("invalid filter entities count: %v", count)
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestSystemsPanicWithoutRecover(t *testing.T) {
+	w := ecs.NewWorld()
+	systems := ecs.NewSystems(w)
+	defer func(world *ecs.World, systems ecs.ISystems) {
+		if r := recover(); r == nil {
+			t.Errorf("code should panic")
+		}
+		systems.Destroy()
+		world.Destroy()
+	}(w, systems)
+	counter := 0
+	systems.Add(&PanicRunSystem1{Counter: &counter})
+	systems.Init()
+	systems.Run()
+	t.Errorf("code should panic")
+}
+
+func TestSystemsRemove(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	counter := 0
+	sys := &LifecycleSystem1{}
+	s.
+		Add(sys).
+		Add(&RunSystem1{Counter: &counter}).
+		Init()
+	s.Run()
+	if err := s.Remove(sys); err != nil {
+		t.Errorf("unexpected remove error: %v", err)
+	}
+	s.Run()
+	if !reflect.DeepEqual(sys.Calls, []string{"PreInit", "Init", "Run", "Destroy", "PostDestroy"}) {
+		t.Errorf("invalid system calls: %v", sys.Calls)
+	}
+	if counter != 2 || len(s.GetAllSystems()) != 1 {
+		t.Errorf("invalid systems after remove")
+	}
+	if err := s.Remove(sys); err == nil {
+		t.Errorf("remove error expected")
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestSystemsReplace(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	listener := systemsEventListener{}
+	oldSys := &LifecycleSystem1{}
+	newSys := &LifecycleSystem1{}
+	s.Add(oldSys)
+	s.AddEventListener(&listener)
+	if listeners := s.GetEventListeners(nil); len(listeners) != 1 || listeners[0] != &listener {
+		t.Errorf("invalid event listeners: %v", listeners)
+	}
+	s.Init()
+	s.Run()
+	if err := s.Replace(oldSys, newSys); err != nil {
+		t.Errorf("unexpected replace error: %v", err)
+	}
+	s.Run()
+	if !reflect.DeepEqual(oldSys.Calls, []string{"PreInit", "Init", "Run", "Destroy", "PostDestroy"}) {
+		t.Errorf("invalid old system calls: %v", oldSys.Calls)
+	}
+	if !reflect.DeepEqual(newSys.Calls, []string{"PreInit", "Init", "Run"}) {
+		t.Errorf("invalid new system calls: %v", newSys.Calls)
+	}
+	if all := s.GetAllSystems(); len(all) != 1 || all[0] != newSys {
+		t.Errorf("invalid systems after replace")
+	}
+	if len(listener.added) != 1 || listener.added[0] != newSys || len(listener.removed) != 1 || listener.removed[0] != oldSys {
+		t.Errorf("invalid listener calls")
+	}
+	s.Destroy()
+	if listener.destroyed != 1 {
+		t.Errorf("invalid listener destroy calls")
+	}
+	w.Destroy()
+}
+
+func TestSystemsReplaceBeforeInit(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	oldSys := &LifecycleSystem1{}
+	newSys := &LifecycleSystem1{}
+	s.Add(oldSys)
+	if err := s.Replace(oldSys, newSys); err != nil {
+		t.Errorf("unexpected replace error: %v", err)
+	}
+	s.Init()
+	if len(oldSys.Calls) != 0 {
+		t.Errorf("invalid old system calls: %v", oldSys.Calls)
+	}
+	if !reflect.DeepEqual(newSys.Calls, []string{"PreInit", "Init"}) {
+		t.Errorf("invalid new system calls: %v", newSys.Calls)
+	}
+	if err := s.Replace(oldSys, newSys); err == nil {
+		t.Errorf("replace error expected")
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestSystemsReplaceWithInitError(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	counter := 0
+	oldSys := &InitErrSystem1{Counter: &counter}
+	s.Add(oldSys).Init()
+	err := s.Replace(oldSys, &InitErrSystem1{Counter: &counter, Fail: true})
+	if !errors.Is(err, errSystemFailed) {
+		t.Errorf("invalid replace error: %v", err)
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestSystemsDelHere(t *testing.T) {
+	w := ecs.NewWorld()
+	s := ecs.NewSystems(w)
+	sys := &OneFrameSystem1{}
+	p2 := ecs.GetPool[C2](w)
+	e := w.NewEntity()
+	p2.Add(e)
+	ecs.GetPool[C1](w).Add(e)
+	ecs.DelHere[C1](s.Add(sys), "").Init()
+	s.Run()
+	s.Run()
+	if !reflect.DeepEqual(sys.Counts, []int{1, 0}) {
+		t.Errorf("invalid filter counts: %v", sys.Counts)
+	}
+	if ecs.GetFilter[ecs.Inc1[C1]](w).GetEntitiesCount() != 0 {
+		t.Errorf("one-frame components should be removed")
+	}
+	if !p2.Has(e) {
+		t.Errorf("other components should be kept")
+	}
+	s.Destroy()
+	w.Destroy()
+}
+
+func TestSystemsDelHereFromUndefinedWorld(t *testing.T) {
+	w := ecs.NewWorld()
+	systems := ecs.NewSystems(w)
+	defer func(world *ecs.World, systems ecs.ISystems) {
+		if r := recover(); r == nil {
+			t.Errorf("code should panic")
+		}
+		systems.Destroy()
+		world.Destroy()
+	}(w, systems)
+	ecs.DelHere[C1](systems, "events").Init()
+	systems.Run()
+	t.Errorf("code should panic")
+}
@@ -11,18 +11,32 @@ import (
 )
 
 type WorldConfig struct {
+	Name                      string
 	WorldEntitiesSize         int
 	WorldEntitiesRecycledSize int
 	WorldPoolsSize            int
 	PoolDenseSize             int
 	PoolRecycledSize          int
 	EntityComponentsSize      int
+	GenOverflowPolicy         GenOverflowPolicy
 }
 
+// GenOverflowPolicy describes behaviour of entity slot on generation overflow.
+type GenOverflowPolicy int
+
+const (
+	// GenOverflowWrap restarts generation from 1, stale handles can be resurrected.
+	GenOverflowWrap GenOverflowPolicy = 0
+	// GenOverflowRetire keeps slot dead forever, it will not be recycled.
+	GenOverflowRetire GenOverflowPolicy = 1
+)
+
+// generation is int32, stored as 2 raw items: low and high parts.
 const (
 	RawEntityOffsetComponentsCount int = 0
 	RawEntityOffsetGen             int = 1
-	RawEntityOffsetComponents      int = 2
+	RawEntityOffsetGenHigh         int = 2
+	RawEntityOffsetComponents      int = 3
 )
 
 const defaultWorldEntitiesSize int = 512
@@ -46,12 +60,21 @@ type World struct {
 	entities            []int16
 	entitiesItemSize    int
 	entitiesRecycled    []int
+	entitiesRetired     int
 	pools               []IPool
 	poolsHashes         map[reflect.Type]IPool
 	filterMaskCache     [][]int16
 	filtersHashes       map[int]*Filter
 	filtersByIncludes   [][]*Filter
 	filtersByExcludes   [][]*Filter
+	filtersLocks        int
+	eventsHashes        map[reflect.Type]iEvents
+	eventsList          []iEvents
+	commands            *CommandBuffer
+	refs                map[int][]entityRefLink
+	refListeners        []IEntityRefListener
+	netIDs              map[NetID]int
+	entityNetIDs        map[int]NetID
 	debugLeakedEntities []int
 	debugEventListeners []IWorldEventListener
 }
@@ -89,6 +112,7 @@ func NewWorldWithConfig(config WorldConfig) *World {
 	w.filtersHashes = make(map[int]*Filter, config.WorldPoolsSize)
 	w.filtersByIncludes = make([][]*Filter, config.WorldPoolsSize)
 	w.filtersByExcludes = make([][]*Filter, config.WorldPoolsSize)
+	w.eventsHashes = make(map[reflect.Type]iEvents)
 	if DEBUG {
 		w.debugLeakedEntities = make([]int, 0, 512)
 	}
@@ -112,11 +136,24 @@ func (w *World) Destroy() {
 	}
 	w.pools = w.pools[:0]
 	w.entitiesRecycled = w.entitiesRecycled[:0]
+	w.entitiesRetired = 0
 	for k := range w.filtersHashes {
 		delete(w.filtersHashes, k)
 	}
+	w.filtersLocks = 0
 	w.filtersByIncludes = w.filtersByIncludes[:0]
 	w.filtersByExcludes = w.filtersByExcludes[:0]
+	for k := range w.eventsHashes {
+		delete(w.eventsHashes, k)
+	}
+	for i := range w.eventsList {
+		w.eventsList[i] = nil
+	}
+	w.eventsList = w.eventsList[:0]
+	w.commands = nil
+	w.refs = nil
+	w.netIDs = nil
+	w.entityNetIDs = nil
 	if DEBUG {
 		for _, l := range w.debugEventListeners {
 			l.OnWorldDestroyed(w)
@@ -124,6 +161,10 @@ func (w *World) Destroy() {
 	}
 }
 
+func (w *World) GetName() string {
+	return w.config.Name
+}
+
 func (w *World) GetRawEntityOffset(entity int) int {
 	return entity * w.entitiesItemSize
 }
@@ -134,7 +175,8 @@ func (w *World) NewEntity() int {
 	if l > 0 {
 		entity = w.entitiesRecycled[l-1]
 		w.entitiesRecycled = w.entitiesRecycled[:l-1]
-		w.entities[w.GetRawEntityOffset(entity)+RawEntityOffsetGen] *= -1
+		offset := w.GetRawEntityOffset(entity)
+		w.setRawEntityGen(offset, -w.getRawEntityGen(offset))
 	} else {
 		// new entity.
 		entity = len(w.entities) / w.entitiesItemSize
@@ -143,7 +185,7 @@ func (w *World) NewEntity() int {
 		for i := 0; i < w.entitiesItemSize; i++ {
 			w.entities = append(w.entities, 0)
 		}
-		w.entities[w.GetRawEntityOffset(entity)+RawEntityOffsetGen] = 1
+		w.setRawEntityGen(w.GetRawEntityOffset(entity), 1)
 		newCap := cap(w.entities)
 		if oldCap != newCap {
 			newCap /= w.entitiesItemSize
@@ -178,7 +220,7 @@ func (w *World) DelEntity(entity int) {
 	}
 	entityOffset := w.GetRawEntityOffset(entity)
 	componentsCount := int(w.entities[entityOffset+RawEntityOffsetComponentsCount])
-	entityGen := w.entities[entityOffset+RawEntityOffsetGen]
+	entityGen := w.getRawEntityGen(entityOffset)
 	// dead entity.
 	if entityGen < 0 {
 		return
@@ -189,13 +231,27 @@ func (w *World) DelEntity(entity int) {
 			w.pools[w.entities[i]].Del(entity)
 		}
 	} else {
-		if entityGen == math.MaxInt16 {
-			entityGen = 1
+		retired := false
+		if entityGen == math.MaxInt32 {
+			retired = w.config.GenOverflowPolicy == GenOverflowRetire
+			if !retired {
+				entityGen = 1
+			}
 		} else {
 			entityGen = entityGen + 1
 		}
-		w.entities[entityOffset+RawEntityOffsetGen] = -entityGen
-		w.entitiesRecycled = append(w.entitiesRecycled, entity)
+		w.setRawEntityGen(entityOffset, -entityGen)
+		if retired {
+			w.entitiesRetired++
+		} else {
+			w.entitiesRecycled = append(w.entitiesRecycled, entity)
+		}
+		if w.netIDs != nil {
+			w.DelEntityNetID(entity)
+		}
+		if w.refs != nil {
+			w.onEntityRefTargetDestroyed(entity)
+		}
 		if DEBUG {
 			for _, l := range w.debugEventListeners {
 				l.OnEntityDestroyed(entity)
@@ -204,8 +260,22 @@ func (w *World) DelEntity(entity int) {
 	}
 }
 
-func (w *World) GetEntityGen(entity int) int16 {
-	return w.entities[w.GetRawEntityOffset(entity)+RawEntityOffsetGen]
+// IsEntityAlive checks that entity id is valid and entity not destroyed, safe for any id.
+func (w *World) IsEntityAlive(entity int) bool {
+	return w.checkEntityAlive(entity)
+}
+
+func (w *World) GetAliveEntitiesCount() int {
+	return len(w.entities)/w.entitiesItemSize - len(w.entitiesRecycled) - w.entitiesRetired
+}
+
+// IterAliveEntities returns iterator over all alive entities (including entities without components).
+func (w *World) IterAliveEntities() EntitiesIter {
+	return EntitiesIter{w: w, idx: -1}
+}
+
+func (w *World) GetEntityGen(entity int) int32 {
+	return w.getRawEntityGen(w.GetRawEntityOffset(entity))
 }
 
 func (w *World) GetEntityComponentsCount(entity int) int16 {
@@ -263,6 +333,21 @@ func DebugGetPoolsPtr(w *World) *[]IPool {
 	return &w.pools
 }
 
+// DebugSetEntityGen overwrites generation of entity (negative value - dead entity),
+// for overflow testing only.
+func DebugSetEntityGen(w *World, entity int, gen int32) {
+	w.setRawEntityGen(w.GetRawEntityOffset(entity), gen)
+}
+
+func (w *World) getRawEntityGen(offset int) int32 {
+	return int32(uint16(w.entities[offset+RawEntityOffsetGen])) | int32(w.entities[offset+RawEntityOffsetGenHigh])<<16
+}
+
+func (w *World) setRawEntityGen(offset int, gen int32) {
+	w.entities[offset+RawEntityOffsetGen] = int16(gen)
+	w.entities[offset+RawEntityOffsetGenHigh] = int16(gen >> 16)
+}
+
 func (w *World) addComponentToRawEntity(entity int, poolId int16) {
 	offset := w.GetRawEntityOffset(entity)
 	dataCount := int(w.entities[offset+RawEntityOffsetComponentsCount])
@@ -333,7 +418,7 @@ func debugCheckWorldForLeakedEntities(w *World) bool {
 	if len(w.debugLeakedEntities) > 0 {
 		for _, leakedEntity := range w.debugLeakedEntities {
 			entityData := w.GetRawEntityOffset(leakedEntity)
-			if w.entities[entityData+RawEntityOffsetGen] > 0 && w.entities[entityData+RawEntityOffsetComponentsCount] == 0 {
+			if w.getRawEntityGen(entityData) > 0 && w.entities[entityData+RawEntityOffsetComponentsCount] == 0 {
 				w.debugLeakedEntities = w.debugLeakedEntities[:0]
 				return true
 			}
@@ -344,5 +429,5 @@ func debugCheckWorldForLeakedEntities(w *World) bool {
 }
 
 func (w *World) checkEntityAlive(entity int) bool {
-	return entity >= 0 && (entity*w.entitiesItemSize) < len(w.entities) && w.entities[w.GetRawEntityOffset(entity)+RawEntityOffsetGen] > 0
+	return entity >= 0 && (entity*w.entitiesItemSize) < len(w.entities) && w.getRawEntityGen(w.GetRawEntityOffset(entity)) > 0
 }
@@ -33,6 +33,14 @@ func TestWorldCreate(t *testing.T) {
 	w.Destroy()
 }
 
+func TestWorldName(t *testing.T) {
+	w := ecs.NewWorldWithConfig(ecs.WorldConfig{Name: "events"})
+	if w.GetName() != "events" {
+		t.Errorf("invalid world name: %s.", w.GetName())
+	}
+	w.Destroy()
+}
+
 func TestWorldResize(t *testing.T) {
 	w := ecs.NewWorldWithConfig(ecs.WorldConfig{WorldEntitiesSize: 2})
 	p := ecs.GetPool[C1](w)
@@ -163,20 +171,53 @@ func TestWorldDelEntityTwice(t *testing.T) {
 }
 
 func TestWorldGenEntityOverflow(t *testing.T) {
+	w := ecs.NewWorld()
+	e := w.NewEntity()
+	ecs.DebugSetEntityGen(w, e, math.MaxInt32)
+	w.DelEntity(e)
+	e = w.NewEntity()
+	gen := w.GetEntityGen(e)
+	if gen != 1 {
+		t.Errorf("invalid entity gen on overflow: %d.", gen)
+	}
+	w.DelEntity(e)
+	w.Destroy()
+}
+
+func TestWorldGenEntityWide(t *testing.T) {
 	w := ecs.NewWorld()
 	for i := 0; i < math.MaxInt16; i++ {
 		e := w.NewEntity()
 		w.DelEntity(e)
 	}
 	e := w.NewEntity()
-	gen := w.GetEntityGen(e)
-	if gen != 1 {
-		t.Errorf("invalid entity gen on overflow: %d.", gen)
+	if gen := w.GetEntityGen(e); gen != math.MaxInt16+1 {
+		t.Errorf("invalid entity gen after int16 range: %d.", gen)
 	}
 	w.DelEntity(e)
 	w.Destroy()
 }
 
+func TestWorldGenEntityOverflowRetire(t *testing.T) {
+	w := ecs.NewWorldWithConfig(ecs.WorldConfig{GenOverflowPolicy: ecs.GenOverflowRetire})
+	e := w.NewEntity()
+	ecs.DebugSetEntityGen(w, e, math.MaxInt32)
+	h := w.GetEntityHandle(e)
+	w.DelEntity(e)
+	if _, ok := h.Unpack(w); ok {
+		t.Errorf("handle of retired entity should be invalid.")
+	}
+	if e2 := w.NewEntity(); e2 == e {
+		t.Errorf("retired entity slot should not be recycled.")
+	} else {
+		w.DelEntity(e2)
+	}
+	if c := w.GetAliveEntitiesCount(); c != 0 {
+		t.Errorf("invalid alive entities count with retired slot: %d", c)
+	}
+	w.Destroy()
+}
+
 type worldEventListener struct{}
 
 func (l *worldEventListener) OnEntityCreated(entity int)        {}
@@ -236,3 +277,33 @@ func TestCopyEntity(t *testing.T) {
 	}
 	w.Destroy()
 }
+
+func TestWorldAliveEntities(t *testing.T) {
+	w := ecs.NewWorld()
+	if w.IsEntityAlive(0) || w.IsEntityAlive(-1) {
+		t.Errorf("invalid entities should not be alive")
+	}
+	e1 := w.NewEntity()
+	e2 := w.NewEntity()
+	e3 := w.NewEntity()
+	ecs.GetPool[C1](w).Add(e1)
+	ecs.GetPool[C1](w).Add(e3)
+	w.DelEntity(e2)
+	if !w.IsEntityAlive(e1) || w.IsEntityAlive(e2) {
+		t.Errorf("invalid alive state")
+	}
+	if c := w.GetAliveEntitiesCount(); c != 2 {
+		t.Errorf("invalid alive entities count: %d", c)
+	}
+	var alive []int
+	for it := w.IterAliveEntities(); it.Next(); {
+		alive = append(alive, it.GetEntity())
+	}
+	if len(alive) != 2 || alive[0] != e1 || alive[1] != e3 {
+		t.Errorf("invalid alive entities: %v", alive)
+	}
+	w.Destroy()
+	if c := w.GetAliveEntitiesCount(); c != 0 {
+		t.Errorf("invalid alive entities count after destroy: %d", c)
+	}
+}